@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+func init() {
+	RegisterDriver("consul", func(cfg json.RawMessage) (Store, error) {
+		var opts struct {
+			Address string `json:"address"`
+			Prefix  string `json:"prefix"`
+			Token   string `json:"token"`
+		}
+		if len(cfg) > 0 {
+			if err := json.Unmarshal(cfg, &opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Address == "" {
+			opts.Address = os.Getenv("CONSUL_ADDR")
+		}
+		if opts.Token == "" {
+			opts.Token = os.Getenv("CONSUL_TOKEN")
+		}
+
+		return NewConsulStore(opts.Address, opts.Prefix, opts.Token)
+	})
+}
+
+// consulEnvelope is what ConsulStore stores in each KV entry's value;
+// Version isn't part of it because Consul already assigns every entry a
+// cluster-wide ModifyIndex, which we use as our version the same way
+// EtcdStore uses etcd's ModRevision.
+type consulEnvelope struct {
+	Value     string    `json:"value"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	DeletedAt time.Time `json:"deleted_at,omitempty"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+}
+
+// ConsulStore implements the Store interface against Consul's KV store,
+// with Watch driven by Consul's blocking queries instead of a separate
+// change feed.
+type ConsulStore struct {
+	kv     *consul.KV
+	prefix string
+}
+
+// NewConsulStore dials the Consul agent at address (empty uses the
+// client's default, http://127.0.0.1:8500). prefix, if non-empty, is
+// prepended to every key so multiple KV stores can share one Consul KV
+// space.
+func NewConsulStore(address, prefix, token string) (*ConsulStore, error) {
+	cfg := consul.DefaultConfig()
+	if address != "" {
+		cfg.Address = address
+	}
+	if token != "" {
+		cfg.Token = token
+	}
+
+	client, err := consul.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulStore{kv: client.KV(), prefix: prefix}, nil
+}
+
+func (c *ConsulStore) path(key string) string {
+	return c.prefix + key
+}
+
+// Set writes key via a plain Put; version is ignored on the way in (Consul
+// assigns the ModifyIndex, there's no way to force an arbitrary one) and
+// the resulting ModifyIndex is returned as our version.
+func (c *ConsulStore) Set(key, value string, version *int) (int, error) {
+	return c.put(key, consulEnvelope{Value: value, AppliedAt: time.Now()})
+}
+
+func (c *ConsulStore) put(key string, env consulEnvelope) (int, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return 0, err
+	}
+
+	pair := &consul.KVPair{Key: c.path(key), Value: data}
+	if _, err := c.kv.Put(pair, nil); err != nil {
+		return 0, err
+	}
+
+	got, _, err := c.kv.Get(c.path(key), nil)
+	if err != nil {
+		return 0, err
+	}
+	if got == nil {
+		return 0, fmt.Errorf("consul: key %q vanished immediately after Put", key)
+	}
+	return int(got.ModifyIndex), nil
+}
+
+// Get retrieves a key-value pair, using the entry's ModifyIndex as its
+// version.
+func (c *ConsulStore) Get(key string) (KVPair, bool, error) {
+	pair, _, err := c.kv.Get(c.path(key), nil)
+	if err != nil {
+		return KVPair{}, false, err
+	}
+	if pair == nil {
+		return KVPair{}, false, nil
+	}
+
+	var env consulEnvelope
+	if err := json.Unmarshal(pair.Value, &env); err != nil {
+		return KVPair{}, false, err
+	}
+
+	return KVPair{
+		Value:     env.Value,
+		Version:   int(pair.ModifyIndex),
+		Deleted:   env.Deleted,
+		DeletedAt: env.DeletedAt,
+		AppliedAt: env.AppliedAt,
+	}, true, nil
+}
+
+// SetReader drains r and stores it the same way Set does; Consul's KV API
+// has no streaming Put, so this can't avoid buffering, but it keeps
+// ConsulStore a drop-in for the streaming interface.
+func (c *ConsulStore) SetReader(key string, r io.Reader, version *int) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return c.Set(key, string(data), version)
+}
+
+// GetReader wraps the stored value in a no-op ReadCloser.
+func (c *ConsulStore) GetReader(key string) (io.ReadCloser, KVPair, bool, error) {
+	pair, exists, err := c.Get(key)
+	if err != nil || !exists {
+		return nil, pair, exists, err
+	}
+	return io.NopCloser(strings.NewReader(pair.Value)), pair, true, nil
+}
+
+// Delete writes a tombstone envelope over the existing key rather than
+// removing it; see the Store.Delete doc comment for why.
+func (c *ConsulStore) Delete(key string) error {
+	pair, _, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+	_, err = c.put(key, consulEnvelope{
+		Value:     pair.Value,
+		Deleted:   true,
+		DeletedAt: time.Now(),
+		AppliedAt: time.Now(),
+	})
+	return err
+}
+
+// Untrash clears a tombstone, restoring the value it shadowed, as long as
+// it is still within TrashLifetime.
+func (c *ConsulStore) Untrash(key string) error {
+	pair, exists, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+	if !exists || !pair.Deleted {
+		return fmt.Errorf("key %q has no tombstone to restore", key)
+	}
+	if time.Since(pair.DeletedAt) > TrashLifetime {
+		return fmt.Errorf("key %q tombstone is past its trash lifetime", key)
+	}
+
+	_, err = c.put(key, consulEnvelope{Value: pair.Value, AppliedAt: time.Now()})
+	return err
+}
+
+// List returns every key currently held, under prefix.
+func (c *ConsulStore) List() ([]string, error) {
+	keys, _, err := c.kv.Keys(c.prefix, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, c.prefix)
+	}
+	return keys, nil
+}
+
+// HealthCheck verifies the Consul agent is reachable.
+func (c *ConsulStore) HealthCheck() error {
+	_, _, err := c.kv.Get(c.prefix, nil)
+	return err
+}
+
+// Watch subscribes to key via Consul's blocking-query long-poll, so the
+// leader can drive replication off Consul's change notifications instead of
+// our usual fan-out POSTs.
+func (c *ConsulStore) Watch(key string) (<-chan Event, func(), error) {
+	ch := make(chan Event, 8)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(ch)
+
+		var lastIndex uint64
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			pair, meta, err := c.kv.Get(c.path(key), &consul.QueryOptions{
+				WaitIndex: lastIndex,
+				WaitTime:  5 * time.Minute,
+			})
+			if err != nil {
+				time.Sleep(time.Second)
+				continue
+			}
+			if meta != nil {
+				lastIndex = meta.LastIndex
+			}
+			if pair == nil {
+				continue
+			}
+
+			var env consulEnvelope
+			if json.Unmarshal(pair.Value, &env) != nil {
+				continue
+			}
+
+			ev := Event{Key: key, Value: env.Value, Version: int(pair.ModifyIndex), Deleted: env.Deleted}
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}()
+
+	stop := func() { close(done) }
+	return ch, stop, nil
+}
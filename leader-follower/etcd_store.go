@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func init() {
+	RegisterDriver("etcd", func(cfg json.RawMessage) (Store, error) {
+		var opts struct {
+			Endpoints          []string `json:"endpoints"`
+			Prefix             string   `json:"prefix"`
+			DialTimeoutSeconds int      `json:"dial_timeout_seconds"`
+		}
+		if len(cfg) > 0 {
+			if err := json.Unmarshal(cfg, &opts); err != nil {
+				return nil, err
+			}
+		}
+		if len(opts.Endpoints) == 0 {
+			if raw := os.Getenv("ETCD_ENDPOINTS"); raw != "" {
+				opts.Endpoints = strings.Split(raw, ",")
+			}
+		}
+		if len(opts.Endpoints) == 0 {
+			return nil, fmt.Errorf("etcd driver requires ETCD_ENDPOINTS")
+		}
+
+		dialTimeout := 5 * time.Second
+		if opts.DialTimeoutSeconds > 0 {
+			dialTimeout = time.Duration(opts.DialTimeoutSeconds) * time.Second
+		}
+
+		return NewEtcdStore(opts.Endpoints, opts.Prefix, dialTimeout)
+	})
+}
+
+// etcdEnvelope is what EtcdStore actually stores at each key; Version isn't
+// part of it because etcd already assigns every write a cluster-wide
+// ModRevision, so we use that as our version instead of tracking one
+// ourselves.
+type etcdEnvelope struct {
+	Value     string    `json:"value"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	DeletedAt time.Time `json:"deleted_at,omitempty"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+}
+
+// EtcdStore implements the Store interface against an etcd v3 cluster,
+// mapping Get/Set/Delete onto etcd KV ops and Watch onto etcd's own watch
+// stream instead of the polling or in-process pub/sub the other backends
+// need.
+type EtcdStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdStore dials the etcd cluster at endpoints. prefix, if non-empty, is
+// prepended to every key so multiple KV stores can share one etcd cluster.
+func NewEtcdStore(endpoints []string, prefix string, dialTimeout time.Duration) (*EtcdStore, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: dialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdStore{client: client, prefix: prefix}, nil
+}
+
+func (e *EtcdStore) path(key string) string {
+	return e.prefix + key
+}
+
+// Set writes key via a plain Put; version is ignored on the way in (etcd
+// assigns the ModRevision, there's no way to force an arbitrary one) and
+// the resulting ModRevision is returned as our version, same as
+// SetReader.
+func (e *EtcdStore) Set(key, value string, version *int) (int, error) {
+	return e.put(key, etcdEnvelope{Value: value, AppliedAt: time.Now()})
+}
+
+func (e *EtcdStore) put(key string, env etcdEnvelope) (int, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Put(ctx, e.path(key), string(data))
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Header.Revision), nil
+}
+
+// Get retrieves a key-value pair, using the key's ModRevision as its
+// version.
+func (e *EtcdStore) Get(key string) (KVPair, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, e.path(key))
+	if err != nil {
+		return KVPair{}, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return KVPair{}, false, nil
+	}
+
+	kv := resp.Kvs[0]
+	var env etcdEnvelope
+	if err := json.Unmarshal(kv.Value, &env); err != nil {
+		return KVPair{}, false, err
+	}
+
+	return KVPair{
+		Value:     env.Value,
+		Version:   int(kv.ModRevision),
+		Deleted:   env.Deleted,
+		DeletedAt: env.DeletedAt,
+		AppliedAt: env.AppliedAt,
+	}, true, nil
+}
+
+// SetReader drains r and stores it the same way Set does; etcd's KV API has
+// no streaming Put, so this can't avoid buffering, but it keeps EtcdStore a
+// drop-in for the streaming interface.
+func (e *EtcdStore) SetReader(key string, r io.Reader, version *int) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return e.Set(key, string(data), version)
+}
+
+// GetReader wraps the stored value in a no-op ReadCloser.
+func (e *EtcdStore) GetReader(key string) (io.ReadCloser, KVPair, bool, error) {
+	pair, exists, err := e.Get(key)
+	if err != nil || !exists {
+		return nil, pair, exists, err
+	}
+	return io.NopCloser(strings.NewReader(pair.Value)), pair, true, nil
+}
+
+// Delete writes a tombstone envelope over the existing key rather than
+// removing it; see the Store.Delete doc comment for why.
+func (e *EtcdStore) Delete(key string) error {
+	pair, _, err := e.Get(key)
+	if err != nil {
+		return err
+	}
+	_, err = e.put(key, etcdEnvelope{
+		Value:     pair.Value,
+		Deleted:   true,
+		DeletedAt: time.Now(),
+		AppliedAt: time.Now(),
+	})
+	return err
+}
+
+// Untrash clears a tombstone, restoring the value it shadowed, as long as
+// it is still within TrashLifetime.
+func (e *EtcdStore) Untrash(key string) error {
+	pair, exists, err := e.Get(key)
+	if err != nil {
+		return err
+	}
+	if !exists || !pair.Deleted {
+		return fmt.Errorf("key %q has no tombstone to restore", key)
+	}
+	if time.Since(pair.DeletedAt) > TrashLifetime {
+		return fmt.Errorf("key %q tombstone is past its trash lifetime", key)
+	}
+
+	_, err = e.put(key, etcdEnvelope{Value: pair.Value, AppliedAt: time.Now()})
+	return err
+}
+
+// List returns every key currently held, under prefix.
+func (e *EtcdStore) List() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, e.prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys = append(keys, strings.TrimPrefix(string(kv.Key), e.prefix))
+	}
+	return keys, nil
+}
+
+// HealthCheck verifies the etcd cluster is reachable.
+func (e *EtcdStore) HealthCheck() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := e.client.Status(ctx, e.client.Endpoints()[0])
+	return err
+}
+
+// Watch subscribes to key via etcd's own watch stream, so the leader can
+// drive replication off etcd's change notifications instead of our usual
+// fan-out POSTs.
+func (e *EtcdStore) Watch(key string) (<-chan Event, func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watchCh := e.client.Watch(ctx, e.path(key))
+
+	ch := make(chan Event, 8)
+	go func() {
+		defer close(ch)
+		for resp := range watchCh {
+			for _, wev := range resp.Events {
+				var env etcdEnvelope
+				if wev.Kv == nil || json.Unmarshal(wev.Kv.Value, &env) != nil {
+					continue
+				}
+				ev := Event{
+					Key:     key,
+					Value:   env.Value,
+					Version: int(wev.Kv.ModRevision),
+					Deleted: env.Deleted,
+				}
+				select {
+				case ch <- ev:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, cancel, nil
+}
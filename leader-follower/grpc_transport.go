@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// defaultReplGRPCPort is the gRPC replication listener's port when
+// REPL_GRPC_PORT isn't set, independent of the client-facing HTTP PORT.
+const defaultReplGRPCPort = "9090"
+
+// replGRPCAddrForFollower derives a follower's gRPC replication address
+// from its FOLLOWER_URLS entry (e.g. "http://follower1:8080" ->
+// "follower1:9090"), so REPL_TRANSPORT=grpc doesn't need a second,
+// per-follower address list alongside the HTTP one.
+func replGRPCAddrForFollower(followerURL string) (string, error) {
+	u, err := url.Parse(followerURL)
+	if err != nil {
+		return "", fmt.Errorf("grpc transport: invalid follower URL %q: %w", followerURL, err)
+	}
+	port := os.Getenv("REPL_GRPC_PORT")
+	if port == "" {
+		port = defaultReplGRPCPort
+	}
+	return u.Hostname() + ":" + port, nil
+}
+
+// grpcAckTimeout bounds how long grpcPeerConn.send waits for a follower's
+// Ack before treating the write as failed, the gRPC equivalent of the
+// implicit timeout http.Post's connection deadline gives the HTTP path.
+const grpcAckTimeout = 5 * time.Second
+
+// replTransport is how LeaderNode reaches a follower's replicate path,
+// letting replicateToFollower stay the single call site regardless of
+// REPL_TRANSPORT. The default (nil transport on LeaderNode) keeps using the
+// existing JSON-over-HTTP POST to /replicate.
+type replTransport interface {
+	replicate(followerURL, key, value string, version int, deleted bool) (time.Time, error)
+}
+
+// buildReplTLSConfig loads this node's client+server certificate from
+// REPL_TLS_CERT/REPL_TLS_KEY and the CA used to verify the peer on both
+// ends from REPL_TLS_CA, so leader<->follower gRPC traffic is mutually
+// authenticated instead of running in the clear. It returns a nil config
+// (and nil error) when none of the three are set, meaning plaintext gRPC.
+func buildReplTLSConfig() (*tls.Config, error) {
+	certFile := os.Getenv("REPL_TLS_CERT")
+	keyFile := os.Getenv("REPL_TLS_KEY")
+	caFile := os.Getenv("REPL_TLS_CA")
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("repl tls: loading cert/key: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("repl tls: reading CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("repl tls: no certificates found in %s", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// grpcPeerConn is one follower's long-lived bidi Apply stream: every write
+// replicateToFollower sends is pipelined onto it without waiting for the
+// previous one's Ack, and a background goroutine matches Acks back to their
+// LogEntry by Seq as they arrive, possibly out of order.
+type grpcPeerConn struct {
+	mu      sync.Mutex
+	conn    *grpc.ClientConn
+	stream  ApplyClientStream
+	pending map[int64]chan *Ack
+	nextSeq int64
+}
+
+// grpcReplTransport implements replTransport over the Replicator gRPC
+// service, dialing and reusing one grpcPeerConn per follower URL.
+type grpcReplTransport struct {
+	tlsConfig *tls.Config
+
+	mu    sync.Mutex
+	peers map[string]*grpcPeerConn
+}
+
+func newGRPCReplTransport(tlsConfig *tls.Config) *grpcReplTransport {
+	return &grpcReplTransport{tlsConfig: tlsConfig, peers: make(map[string]*grpcPeerConn)}
+}
+
+// peer returns followerURL's grpcPeerConn, dialing and opening a fresh
+// Apply stream if this is the first write to it or the previous stream
+// died. followerURL is the same "http://host:port" string FOLLOWER_URLS
+// already uses; grpc traffic goes to the same host on REPL_GRPC_PORT
+// instead of PORT.
+func (t *grpcReplTransport) peer(followerURL string) (*grpcPeerConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if p, ok := t.peers[followerURL]; ok && p.stream != nil {
+		return p, nil
+	}
+
+	addr, err := replGRPCAddrForFollower(followerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialOpts []grpc.DialOption
+	if t.tlsConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(t.tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("grpc dial %s: %w", addr, err)
+	}
+
+	stream, err := newGRPCReplicatorClient(conn).Apply(context.Background())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("grpc Apply stream to %s: %w", addr, err)
+	}
+
+	p := &grpcPeerConn{conn: conn, stream: stream, pending: make(map[int64]chan *Ack)}
+	go p.pumpAcks()
+	t.peers[followerURL] = p
+	return p, nil
+}
+
+// pumpAcks reads Acks off the stream for as long as it's alive, resolving
+// each one's pending channel by Seq. Once Recv errors (peer gone, stream
+// reset) it fails every still-pending send and marks the stream dead so the
+// next peer() call redials instead of reusing a broken one.
+func (p *grpcPeerConn) pumpAcks() {
+	for {
+		ack, err := p.stream.Recv()
+		if err != nil {
+			p.mu.Lock()
+			for _, ch := range p.pending {
+				close(ch)
+			}
+			p.pending = make(map[int64]chan *Ack)
+			p.stream = nil
+			p.mu.Unlock()
+			return
+		}
+
+		p.mu.Lock()
+		ch, ok := p.pending[ack.Seq]
+		delete(p.pending, ack.Seq)
+		p.mu.Unlock()
+		if ok {
+			ch <- ack
+		}
+	}
+}
+
+func (p *grpcPeerConn) send(key, value string, version int, deleted bool) (time.Time, error) {
+	p.mu.Lock()
+	stream := p.stream
+	if stream == nil {
+		p.mu.Unlock()
+		return time.Time{}, fmt.Errorf("grpc replicate: stream not connected")
+	}
+	p.nextSeq++
+	seq := p.nextSeq
+	ch := make(chan *Ack, 1)
+	p.pending[seq] = ch
+	p.mu.Unlock()
+
+	if err := stream.Send(&LogEntry{Seq: seq, Key: key, Value: value, Version: version, Deleted: deleted}); err != nil {
+		return time.Time{}, err
+	}
+
+	select {
+	case ack, ok := <-ch:
+		if !ok {
+			return time.Time{}, fmt.Errorf("grpc replicate: stream closed before ack for seq %d", seq)
+		}
+		if ack.Error != "" {
+			return time.Time{}, fmt.Errorf("grpc replicate: %s", ack.Error)
+		}
+		return time.Unix(0, ack.AppliedAtUnixNano), nil
+	case <-time.After(grpcAckTimeout):
+		return time.Time{}, fmt.Errorf("grpc replicate: timed out waiting for ack (seq %d)", seq)
+	}
+}
+
+func (t *grpcReplTransport) replicate(followerURL, key, value string, version int, deleted bool) (time.Time, error) {
+	p, err := t.peer(followerURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return p.send(key, value, version, deleted)
+}
+
+// grpcReplicationServer implements replicatorServer. On a follower node
+// applyFn is a thin wrapper over FollowerNode.Replicate, so an incoming
+// Apply stream lands on the exact same path the HTTP /replicate handler
+// does; on a leader applyFn is nil and Apply rejects - only Snapshot
+// (reading the leader's own store) makes sense there.
+type grpcReplicationServer struct {
+	store   Store
+	applyFn func(key, value string, version int, deleted bool) (time.Time, error)
+}
+
+func (s *grpcReplicationServer) Apply(stream ApplyServerStream) error {
+	if s.applyFn == nil {
+		return status.Error(codes.Unimplemented, "this node does not accept replicated writes")
+	}
+
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &Ack{Seq: entry.Seq}
+		appliedAt, err := s.applyFn(entry.Key, entry.Value, entry.Version, entry.Deleted)
+		if err != nil {
+			ack.Error = err.Error()
+		} else {
+			ack.AppliedAtUnixNano = appliedAt.UnixNano()
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// snapshotChunkSize bounds how many keys Snapshot batches into one Chunk,
+// so bootstrapping a follower with a huge keyspace doesn't have to buffer
+// it all in one message.
+const snapshotChunkSize = 100
+
+func (s *grpcReplicationServer) Snapshot(_ *SnapshotReq, stream SnapshotServerStream) error {
+	keys, err := s.store.List()
+	if err != nil {
+		return err
+	}
+
+	pairs := make(map[string]KVPairProto, snapshotChunkSize)
+	for _, key := range keys {
+		pair, exists, err := s.store.Get(key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		pairs[key] = KVPairProto{
+			Value:             pair.Value,
+			Version:           pair.Version,
+			Deleted:           pair.Deleted,
+			AppliedAtUnixNano: pair.AppliedAt.UnixNano(),
+		}
+		if len(pairs) >= snapshotChunkSize {
+			if err := stream.Send(&Chunk{Pairs: pairs}); err != nil {
+				return err
+			}
+			pairs = make(map[string]KVPairProto, snapshotChunkSize)
+		}
+	}
+	if len(pairs) > 0 {
+		if err := stream.Send(&Chunk{Pairs: pairs}); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&Chunk{Done: true})
+}
+
+// RunGRPCReplicationServer starts the gRPC listener inter-node replication
+// traffic uses when REPL_TRANSPORT=grpc, serving Replicator.Apply (when
+// applyFn is non-nil) and Replicator.Snapshot over addr. It blocks serving
+// until the listener can't be opened or Serve exits; callers start it with
+// `go`.
+func RunGRPCReplicationServer(addr string, store Store, applyFn func(key, value string, version int, deleted bool) (time.Time, error), tlsConfig *tls.Config) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("grpc replication server: listen failed", "addr", addr, "error", err)
+		return
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	registerReplicatorServer(grpcServer, &grpcReplicationServer{store: store, applyFn: applyFn})
+
+	logger.Info("grpc replication server listening", "addr", addr, "tls", tlsConfig != nil)
+	if err := grpcServer.Serve(lis); err != nil {
+		logger.Error("grpc replication server exited", "error", err)
+	}
+}
+
+// followerApplyFunc adapts FollowerNode.Replicate's (status, appliedAt)
+// return to the (appliedAt, error) shape grpcReplicationServer.applyFn
+// expects, so an incoming Apply stream lands on the exact same path the
+// HTTP /replicate handler does.
+func followerApplyFunc(fn *FollowerNode) func(key, value string, version int, deleted bool) (time.Time, error) {
+	return func(key, value string, version int, deleted bool) (time.Time, error) {
+		statusCode, appliedAt := fn.Replicate(key, value, version, deleted)
+		if statusCode != 201 {
+			return time.Time{}, fmt.Errorf("replicate failed with status %d", statusCode)
+		}
+		return appliedAt, nil
+	}
+}
+
+// replGRPCAddr is the address this node's own gRPC replication listener
+// binds, derived from REPL_GRPC_PORT (see replGRPCAddrForFollower).
+func replGRPCAddr() string {
+	port := os.Getenv("REPL_GRPC_PORT")
+	if port == "" {
+		port = defaultReplGRPCPort
+	}
+	return ":" + port
+}
+
+// BootstrapFromSnapshot dials leaderGRPCAddr and applies its Snapshot
+// straight into fn's store, for bringing up a new follower (or one that
+// fell too far behind for hinted handoff to catch up cheaply) without
+// replaying its entire write history.
+func (fn *FollowerNode) BootstrapFromSnapshot(leaderGRPCAddr string, tlsConfig *tls.Config) error {
+	var dialOpts []grpc.DialOption
+	if tlsConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	conn, err := grpc.Dial(leaderGRPCAddr, dialOpts...)
+	if err != nil {
+		return fmt.Errorf("grpc dial %s: %w", leaderGRPCAddr, err)
+	}
+	defer conn.Close()
+
+	stream, err := newGRPCReplicatorClient(conn).Snapshot(context.Background(), &SnapshotReq{})
+	if err != nil {
+		return fmt.Errorf("grpc Snapshot stream to %s: %w", leaderGRPCAddr, err)
+	}
+
+	applied := 0
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF || (chunk != nil && chunk.Done) {
+			logger.Info("bootstrap from snapshot complete", "peer", leaderGRPCAddr, "keys_applied", applied)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("grpc Snapshot recv: %w", err)
+		}
+
+		for key, pair := range chunk.Pairs {
+			if pair.Deleted {
+				if err := fn.store.Delete(key); err != nil {
+					return fmt.Errorf("bootstrap: delete %s: %w", key, err)
+				}
+				continue
+			}
+			if _, err := fn.store.Set(key, pair.Value, &pair.Version); err != nil {
+				return fmt.Errorf("bootstrap: set %s: %w", key, err)
+			}
+			applied++
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestReplGRPCAddrForFollower checks the http(s) FOLLOWER_URLS ->
+// host:REPL_GRPC_PORT translation replicateToFollower's gRPC transport
+// relies on to find a peer without a second, gRPC-specific address list.
+func TestReplGRPCAddrForFollower(t *testing.T) {
+	os.Unsetenv("REPL_GRPC_PORT")
+
+	addr, err := replGRPCAddrForFollower("http://follower1:8080")
+	if err != nil {
+		t.Fatalf("replGRPCAddrForFollower failed: %v", err)
+	}
+	if addr != "follower1:"+defaultReplGRPCPort {
+		t.Errorf("expected follower1:%s, got %s", defaultReplGRPCPort, addr)
+	}
+
+	os.Setenv("REPL_GRPC_PORT", "9999")
+	defer os.Unsetenv("REPL_GRPC_PORT")
+
+	addr, err = replGRPCAddrForFollower("http://follower2:8080")
+	if err != nil {
+		t.Fatalf("replGRPCAddrForFollower failed: %v", err)
+	}
+	if addr != "follower2:9999" {
+		t.Errorf("expected follower2:9999, got %s", addr)
+	}
+
+	if _, err := replGRPCAddrForFollower("://bad-url"); err == nil {
+		t.Errorf("expected an error for an unparseable follower URL")
+	}
+}
+
+// TestKVJSONCodecRoundTrip checks the codec Apply/Snapshot send over the
+// wire instead of protoc-generated Marshal/Unmarshal.
+func TestKVJSONCodecRoundTrip(t *testing.T) {
+	codec := kvJSONCodec{}
+
+	entry := &LogEntry{Seq: 1, Key: "foo", Value: "bar", Version: 3, Deleted: false}
+	data, err := codec.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var decoded LogEntry
+	if err := codec.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded != *entry {
+		t.Errorf("expected %+v, got %+v", *entry, decoded)
+	}
+}
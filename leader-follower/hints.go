@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hintKeyPrefix namespaces hinted-handoff entries within the leader's own
+// Store, so persisting them needs nothing beyond the backend already
+// configured for live data - no separate queue store to deploy or back up.
+const hintKeyPrefix = "__hint__:"
+
+// hintTTL is how long a queued hint is kept before it's dropped as stale
+// rather than replayed; a follower down for longer than this is assumed to
+// need a full resync (read-repair or anti-entropy) rather than a replay of
+// every write it missed.
+const hintTTL = 24 * time.Hour
+
+// hintMaxPerPeer bounds how many writes are queued for a single down
+// follower before the oldest hint is dropped to make room, so a follower
+// that's down for a long time can't grow the queue without limit.
+const hintMaxPerPeer = 10000
+
+// hintInitialBackoff and hintMaxBackoff bound RunHintedHandoff's retry
+// delay for a peer that's still unreachable: it doubles after every failed
+// drain attempt up to the max, and resets once a hint is delivered.
+const (
+	hintInitialBackoff = 1 * time.Second
+	hintMaxBackoff     = 2 * time.Minute
+)
+
+// Hint is one write a follower missed, queued for later replay.
+type Hint struct {
+	TargetURL string    `json:"target_url"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Version   int       `json:"version"`
+	Deleted   bool      `json:"deleted"`
+	Ts        time.Time `json:"ts"`
+	seq       int64     // not persisted; recovered from the hint's store key for ordering
+}
+
+// peerBackoff tracks the retry delay RunHintedHandoff is currently using
+// for a peer, so a peer that keeps failing is retried less often instead of
+// hammering it every tick.
+type peerBackoff struct {
+	mu      sync.Mutex
+	nextTry map[string]time.Time
+	delay   map[string]time.Duration
+}
+
+func newPeerBackoff() *peerBackoff {
+	return &peerBackoff{
+		nextTry: make(map[string]time.Time),
+		delay:   make(map[string]time.Duration),
+	}
+}
+
+func (b *peerBackoff) ready(peerURL string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().After(b.nextTry[peerURL])
+}
+
+func (b *peerBackoff) recordFailure(peerURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delay := b.delay[peerURL] * 2
+	if delay == 0 {
+		delay = hintInitialBackoff
+	}
+	if delay > hintMaxBackoff {
+		delay = hintMaxBackoff
+	}
+	b.delay[peerURL] = delay
+	b.nextTry[peerURL] = time.Now().Add(delay)
+}
+
+func (b *peerBackoff) recordSuccess(peerURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.delay, peerURL)
+	delete(b.nextTry, peerURL)
+}
+
+// hintKey builds the Store key a hint is persisted under. Keys sort
+// lexicographically by peer then by zero-padded sequence number, so
+// List+sort.Strings recovers FIFO order per peer without needing a
+// separate index.
+func hintKey(peerURL string, seq int64) string {
+	return fmt.Sprintf("%s%s:%020d", hintKeyPrefix, peerURL, seq)
+}
+
+// queueHint persists a write this node couldn't deliver to followerURL, so
+// RunHintedHandoff can replay it once that follower recovers. Hints are
+// stored directly in ln.store (under the hintKeyPrefix namespace) so they
+// survive this process restarting, reusing whatever durability the
+// configured backend already provides.
+func (ln *LeaderNode) queueHint(followerURL, key, value string, version int, deleted bool) {
+	seq := atomic.AddInt64(&ln.hintSeq, 1)
+	hint := Hint{
+		TargetURL: followerURL,
+		Key:       key,
+		Value:     value,
+		Version:   version,
+		Deleted:   deleted,
+		Ts:        time.Now(),
+	}
+
+	data, err := json.Marshal(hint)
+	if err != nil {
+		logger.Error("hinted handoff: failed to marshal hint", "peer", followerURL, "error", err)
+		return
+	}
+	if _, err := ln.store.Set(hintKey(followerURL, seq), string(data), nil); err != nil {
+		logger.Error("hinted handoff: failed to persist hint", "peer", followerURL, "error", err)
+		return
+	}
+
+	ln.evictOldestIfOverCap(followerURL)
+}
+
+// evictOldestIfOverCap drops the oldest queued hint for followerURL once
+// its queue has grown past hintMaxPerPeer, so a follower that's down
+// indefinitely can't grow the queue without bound.
+func (ln *LeaderNode) evictOldestIfOverCap(followerURL string) {
+	hints, err := ln.peerHints(followerURL)
+	if err != nil || len(hints) <= hintMaxPerPeer {
+		return
+	}
+	oldest := hints[0]
+	if err := ln.removeHint(hintKey(oldest.TargetURL, oldest.seq)); err != nil {
+		logger.Error("hinted handoff: failed to evict oldest hint", "peer", followerURL, "error", err)
+	}
+}
+
+// removeHint physically removes a delivered or evicted hint. Hints are
+// internal bookkeeping, not client data, so - unlike Store.Delete's usual
+// tombstone contract - there's no reason to keep a record of the deletion
+// around; HardDelete is used where the backend supports it so peerHints'
+// List/Get scan never has to wade through stale hint tombstones.
+func (ln *LeaderNode) removeHint(key string) error {
+	if deleter, ok := ln.store.(HardDeleter); ok {
+		return deleter.HardDelete(key)
+	}
+	return ln.store.Delete(key)
+}
+
+// peerHints lists every hint currently queued for followerURL, oldest
+// first, skipping (and best-effort deleting) any that's past hintTTL.
+func (ln *LeaderNode) peerHints(followerURL string) ([]Hint, error) {
+	keys, err := ln.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := hintKeyPrefix + followerURL + ":"
+	var matched []string
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			matched = append(matched, k)
+		}
+	}
+	sort.Strings(matched)
+
+	hints := make([]Hint, 0, len(matched))
+	for _, k := range matched {
+		pair, exists, err := ln.store.Get(k)
+		if err != nil || !exists || pair.Deleted {
+			continue // already delivered/evicted (or tombstoned on a backend without HardDelete)
+		}
+		var h Hint
+		if err := json.Unmarshal([]byte(pair.Value), &h); err != nil {
+			continue
+		}
+		if time.Since(h.Ts) > hintTTL {
+			_ = ln.removeHint(k)
+			continue
+		}
+		fmt.Sscanf(strings.TrimPrefix(k, prefix), "%d", &h.seq)
+		hints = append(hints, h)
+	}
+	return hints, nil
+}
+
+// Hints returns every currently queued hint, keyed by target follower, for
+// the /hints/status inspection endpoint.
+func (ln *LeaderNode) Hints() map[string][]Hint {
+	snapshot := make(map[string][]Hint)
+	for _, followerURL := range ln.followerURLs {
+		hints, err := ln.peerHints(followerURL)
+		if err != nil || len(hints) == 0 {
+			continue
+		}
+		snapshot[followerURL] = hints
+	}
+	return snapshot
+}
+
+// RunHintedHandoff periodically drains each follower's hint queue, skipping
+// peers still inside their backoff window. It never returns; callers start
+// it with `go`.
+func (ln *LeaderNode) RunHintedHandoff(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		ln.drainAllPeers()
+	}
+}
+
+// drainAllPeers attempts one drain pass over every follower and refreshes
+// the hints_pending gauge, whether or not anything was queued.
+func (ln *LeaderNode) drainAllPeers() {
+	for _, followerURL := range ln.followerURLs {
+		hints, err := ln.peerHints(followerURL)
+		if err != nil {
+			logger.Error("hinted handoff: listing hints failed", "peer", followerURL, "error", err)
+			continue
+		}
+		hintsPending.WithLabelValues(followerURL).Set(float64(len(hints)))
+
+		if len(hints) == 0 || !ln.hintBackoff.ready(followerURL) {
+			continue
+		}
+		ln.drainPeer(followerURL, hints)
+	}
+}
+
+// drainPeer replays followerURL's queued hints in order, stopping at the
+// first failure (and backing off) so hints are never replayed out of
+// order.
+func (ln *LeaderNode) drainPeer(followerURL string, hints []Hint) {
+	for _, h := range hints {
+		if err := ln.replicateToFollower(followerURL, h.Key, h.Value, h.Version, h.Deleted); err != nil {
+			logger.Warn("hinted handoff: peer still unreachable", "peer", followerURL, "queued", len(hints), "error", err)
+			ln.hintBackoff.recordFailure(followerURL)
+			return
+		}
+		if err := ln.removeHint(hintKey(followerURL, h.seq)); err != nil {
+			logger.Error("hinted handoff: failed to clear delivered hint", "peer", followerURL, "error", err)
+		}
+	}
+	ln.hintBackoff.recordSuccess(followerURL)
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,6 +17,33 @@ import (
 type KVPair struct {
 	Value   string `json:"value"`
 	Version int    `json:"version"`
+	// ETag is populated by backends that support conditional writes (S3);
+	// it is empty for backends where it doesn't apply.
+	ETag string `json:"etag,omitempty"`
+	// Deleted marks this pair as a tombstone: Delete doesn't remove the
+	// record, it writes one of these so the deletion itself has a version
+	// that can be compared and replicated like any other write.
+	Deleted   bool      `json:"deleted,omitempty"`
+	DeletedAt time.Time `json:"deleted_at,omitempty"`
+	// AppliedAt is the wall-clock time this replica locally committed this
+	// version, used to decide whether a bounded-staleness read can be
+	// served from it. It's per-replica: the same version can carry a
+	// different AppliedAt on the leader and on each follower.
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	// Clock is this pair's vector clock, populated only on stores that
+	// implement VersionVectorStore; it's empty on backends that only ever
+	// see plain Set/Get.
+	Clock VectorClock `json:"clock,omitempty"`
+}
+
+// causalState is a KVStore-private record of a key's vector clock and any
+// unresolved siblings, tracked alongside (not instead of) the store's
+// regular versioned value so VersionVectorStore can layer on top of the
+// existing Set/Get path without changing it.
+type causalState struct {
+	clock    VectorClock
+	value    string
+	siblings []Sibling
 }
 
 // KVStore is an in-memory key-value store
@@ -20,6 +51,16 @@ type KVStore struct {
 	store          map[string]KVPair
 	mu             sync.RWMutex
 	versionCounter int
+	watchHub
+
+	causalMu sync.Mutex
+	causal   map[string]*causalState
+}
+
+func init() {
+	RegisterDriver("memory", func(cfg json.RawMessage) (Store, error) {
+		return NewKVStore(), nil
+	})
 }
 
 // NewKVStore creates a new KVStore
@@ -27,11 +68,12 @@ func NewKVStore() *KVStore {
 	return &KVStore{
 		store:          make(map[string]KVPair),
 		versionCounter: 0,
+		causal:         make(map[string]*causalState),
 	}
 }
 
 // Set stores a key-value pair with optional version
-func (kv *KVStore) Set(key, value string, version *int) int {
+func (kv *KVStore) Set(key, value string, version *int) (int, error) {
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
 
@@ -47,84 +89,404 @@ func (kv *KVStore) Set(key, value string, version *int) int {
 	}
 
 	kv.store[key] = KVPair{
-		Value:   value,
-		Version: v,
+		Value:     value,
+		Version:   v,
+		AppliedAt: time.Now(),
 	}
+	kv.notify(Event{Key: key, Value: value, Version: v})
 
-	return v
+	return v, nil
 }
 
 // Get retrieves a key-value pair
-func (kv *KVStore) Get(key string) (KVPair, bool) {
+func (kv *KVStore) Get(key string) (KVPair, bool, error) {
 	kv.mu.RLock()
 	defer kv.mu.RUnlock()
 
 	pair, exists := kv.store[key]
-	return pair, exists
+	return pair, exists, nil
+}
+
+// SetReader drains r into memory and stores it; the in-memory backend has
+// no way to avoid buffering, but it still satisfies the streaming interface
+// so it can stand in for S3 in tests.
+func (kv *KVStore) SetReader(key string, r io.Reader, version *int) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return kv.Set(key, string(data), version)
+}
+
+// GetReader wraps the stored value in a no-op ReadCloser.
+func (kv *KVStore) GetReader(key string) (io.ReadCloser, KVPair, bool, error) {
+	pair, exists, err := kv.Get(key)
+	if err != nil || !exists {
+		return nil, pair, exists, err
+	}
+	return io.NopCloser(strings.NewReader(pair.Value)), pair, true, nil
+}
+
+// Delete writes a tombstone over the existing pair rather than removing it;
+// see the Store.Delete doc comment for why.
+func (kv *KVStore) Delete(key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.versionCounter++
+	existing := kv.store[key]
+	existing.Version = kv.versionCounter
+	existing.Deleted = true
+	existing.DeletedAt = time.Now()
+	existing.AppliedAt = time.Now()
+	kv.store[key] = existing
+	kv.notify(Event{Key: key, Version: existing.Version, Deleted: true})
+	return nil
+}
+
+// Untrash clears a tombstone, restoring the value it shadowed, as long as
+// it is still within TrashLifetime.
+func (kv *KVStore) Untrash(key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	pair, exists := kv.store[key]
+	if !exists || !pair.Deleted {
+		return fmt.Errorf("key %q has no tombstone to restore", key)
+	}
+	if time.Since(pair.DeletedAt) > TrashLifetime {
+		return fmt.Errorf("key %q tombstone is past its trash lifetime", key)
+	}
+
+	kv.versionCounter++
+	pair.Version = kv.versionCounter
+	pair.Deleted = false
+	pair.DeletedAt = time.Time{}
+	pair.AppliedAt = time.Now()
+	kv.store[key] = pair
+	kv.notify(Event{Key: key, Value: pair.Value, Version: pair.Version})
+	return nil
+}
+
+// Watch subscribes to changes on key via the shared in-process watchHub.
+func (kv *KVStore) Watch(key string) (<-chan Event, func(), error) {
+	return kv.watch(key)
+}
+
+// SetVC implements VersionVectorStore by merging context with key's
+// existing clock, detecting a conflicting write when context doesn't cover
+// key's existing clock (nil, stale, or concurrent with it), and keeping the
+// displaced value as a sibling instead of overwriting it.
+func (kv *KVStore) SetVC(key, value string, context VectorClock, nodeID string) (KVPair, []Sibling, error) {
+	kv.causalMu.Lock()
+	cur := kv.causal[key]
+	var siblings []Sibling
+	clock := context.clone()
+	if cur != nil {
+		if rel := compareClocks(context, cur.clock); rel == clockBefore || rel == clockConcurrent {
+			siblings = append(append([]Sibling{}, cur.siblings...), Sibling{Value: cur.value, Clock: cur.clock})
+		}
+		clock = clock.merge(cur.clock)
+	}
+	clock[nodeID]++
+	kv.causal[key] = &causalState{clock: clock, value: value, siblings: siblings}
+	kv.causalMu.Unlock()
+
+	version, err := kv.Set(key, value, nil)
+	if err != nil {
+		return KVPair{}, nil, err
+	}
+	return KVPair{Value: value, Version: version, Clock: clock}, siblings, nil
+}
+
+// Resolve implements VersionVectorStore by writing back the client's chosen
+// value with a clock that merges chosen with whatever is currently stored,
+// clearing any siblings - this is the client's explicit answer to a
+// sibling set it already read, not a new concurrent write.
+func (kv *KVStore) Resolve(key, value string, chosen VectorClock, nodeID string) (KVPair, error) {
+	kv.causalMu.Lock()
+	cur := kv.causal[key]
+	clock := chosen.clone()
+	if cur != nil {
+		clock = clock.merge(cur.clock)
+	}
+	clock[nodeID]++
+	kv.causal[key] = &causalState{clock: clock, value: value}
+	kv.causalMu.Unlock()
+
+	version, err := kv.Set(key, value, nil)
+	if err != nil {
+		return KVPair{}, err
+	}
+	return KVPair{Value: value, Version: version, Clock: clock}, nil
+}
+
+// CausalGet implements VersionVectorStore, returning the clock/siblings
+// recorded the last time key went through SetVC or Resolve.
+func (kv *KVStore) CausalGet(key string) (VectorClock, []Sibling, bool) {
+	kv.causalMu.Lock()
+	defer kv.causalMu.Unlock()
+
+	cur := kv.causal[key]
+	if cur == nil {
+		return nil, nil, false
+	}
+	return cur.clock.clone(), append([]Sibling{}, cur.siblings...), true
+}
+
+// HardDelete physically removes a key, tombstoned or not. It's used by the
+// trash sweeper once a tombstone has aged past TrashLifetime.
+func (kv *KVStore) HardDelete(key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	delete(kv.store, key)
+	return nil
+}
+
+// List returns every key currently held
+func (kv *KVStore) List() ([]string, error) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+
+	keys := make([]string, 0, len(kv.store))
+	for k := range kv.store {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// HealthCheck always succeeds for the in-memory backend
+func (kv *KVStore) HealthCheck() error {
+	return nil
 }
 
+// ReadConsistency selects how LeaderNode.Read is allowed to satisfy a read.
+type ReadConsistency string
+
+const (
+	// ConsistencyStrong is the existing R-quorum read: it's always correct
+	// but always pays the round-trip cost to ln.r replicas.
+	ConsistencyStrong ReadConsistency = "strong"
+	// ConsistencyBounded serves directly from any single replica (leader
+	// preferred) whose AppliedAt for this key is within the requested
+	// staleness, falling back to a quorum read if none qualifies.
+	ConsistencyBounded ReadConsistency = "bounded"
+	// ConsistencyEventual serves directly from any single replica with no
+	// staleness check at all, the cheapest and least consistent option.
+	ConsistencyEventual ReadConsistency = "eventual"
+)
+
 // LeaderNode represents a leader in the Leader-Follower architecture
 type LeaderNode struct {
-	kvStore      *KVStore
+	store        Store
 	followerURLs []string
 	w            int // Write quorum
 	r            int // Read quorum
+
+	// nodeID identifies this leader's component in the vector clocks
+	// SetVC/Resolve maintain on a VersionVectorStore. It's a leader-side
+	// identity, unrelated to raft's NODE_ID: this architecture still has
+	// exactly one writer, so causality here tracks concurrent client
+	// writes racing the same leader rather than writes from distinct
+	// coordinators.
+	nodeID string
+
+	// safeTimestamps is the max AppliedAt each follower has acked over
+	// /replicate, gossiped back on every ack. Bounded-staleness reads use
+	// it to pick a follower likely to satisfy the bound without having to
+	// guess blindly and eat a wasted round trip.
+	safeTimestampsMu sync.RWMutex
+	safeTimestamps   map[string]time.Time
+
+	// txnMu is the shard mutex Txn takes for the duration of evaluating
+	// its compares and applying its chosen branch, so two concurrent
+	// transactions can't interleave a read of a stale version with a
+	// write based on it.
+	txnMu sync.Mutex
+
+	// hintSeq assigns each queued Hint a monotonically increasing sequence
+	// number, so its Store key sorts into FIFO order per peer.
+	hintSeq int64
+	// hintBackoff tracks RunHintedHandoff's current per-peer retry delay.
+	hintBackoff *peerBackoff
+
+	// transport is how replicateToFollower reaches a follower. nil keeps
+	// the original JSON-over-HTTP POST to /replicate; REPL_TRANSPORT=grpc
+	// wires in a *grpcReplTransport instead (see grpc_transport.go).
+	transport replTransport
 }
 
-// NewLeaderNode creates a new leader node
-func NewLeaderNode(followerURLs []string, w, r int) *LeaderNode {
+// NewLeaderNode creates a new leader node. transport is nil for the
+// original HTTP replication path, or a *grpcReplTransport when
+// REPL_TRANSPORT=grpc.
+func NewLeaderNode(store Store, followerURLs []string, w, r int, nodeID string, transport replTransport) *LeaderNode {
+	clusterMembers.WithLabelValues(nodeID, "leader").Set(1)
+	for _, followerURL := range followerURLs {
+		clusterMembers.WithLabelValues(followerURL, "follower").Set(1)
+	}
+
 	return &LeaderNode{
-		kvStore:      NewKVStore(),
-		followerURLs: followerURLs,
-		w:            w,
-		r:            r,
+		store:          store,
+		followerURLs:   followerURLs,
+		w:              w,
+		r:              r,
+		nodeID:         nodeID,
+		safeTimestamps: make(map[string]time.Time),
+		hintBackoff:    newPeerBackoff(),
+		transport:      transport,
 	}
 }
 
-// Write performs a write operation with replication
-func (ln *LeaderNode) Write(key, value string) (int, int, error) {
+// Write performs a write operation with replication. context is the vector
+// clock the client last saw for key (nil if it has none); on a store that
+// implements VersionVectorStore, a context that doesn't account for what's
+// currently stored produces a conflict, and the discarded value is
+// returned in siblings instead of being silently overwritten.
+func (ln *LeaderNode) Write(key, value string, context VectorClock) (int, KVPair, []Sibling, error) {
 	if key == "" {
-		return 400, 0, fmt.Errorf("key cannot be empty")
+		return 400, KVPair{}, nil, fmt.Errorf("key cannot be empty")
 	}
 
+	var pair KVPair
+	var siblings []Sibling
+	var err error
+
 	// Leader writes locally first
-	version := ln.kvStore.Set(key, value, nil)
+	if vc, ok := ln.store.(VersionVectorStore); ok {
+		pair, siblings, err = vc.SetVC(key, value, context, ln.nodeID)
+	} else {
+		pair.Version, err = ln.store.Set(key, value, nil)
+		pair.Value = value
+	}
+	if err != nil {
+		if errors.Is(err, ErrConflict) {
+			writesTotal.WithLabelValues("conflict").Inc()
+			return 409, KVPair{}, nil, err
+		}
+		writesTotal.WithLabelValues("error").Inc()
+		return 500, KVPair{}, nil, err
+	}
+
+	statusCode, err := ln.replicateToQuorum(key, value, pair.Version, false)
+	writesTotal.WithLabelValues(writeResultLabel(statusCode)).Inc()
+	return statusCode, pair, siblings, err
+}
+
+// Resolve lets a client collapse key's sibling set by writing back the
+// value it chose, with chosen (the merged context it read from /get)
+// folded into key's clock - the Dynamo-style counterpart to Write for a
+// conflict a client has already looked at and decided how to merge.
+func (ln *LeaderNode) Resolve(key, value string, chosen VectorClock) (int, KVPair, error) {
+	vc, ok := ln.store.(VersionVectorStore)
+	if !ok {
+		return 501, KVPair{}, fmt.Errorf("store does not support sibling resolution")
+	}
+
+	pair, err := vc.Resolve(key, value, chosen, ln.nodeID)
+	if err != nil {
+		writesTotal.WithLabelValues("error").Inc()
+		return 500, KVPair{}, err
+	}
+
+	statusCode, err := ln.replicateToQuorum(key, value, pair.Version, false)
+	writesTotal.WithLabelValues(writeResultLabel(statusCode)).Inc()
+	return statusCode, pair, err
+}
+
+// writeResultLabel maps a Write/Resolve status code to the writesTotal
+// "result" label, so the metric reads the same way the HTTP response does.
+func writeResultLabel(statusCode int) string {
+	switch statusCode {
+	case 201:
+		return "success"
+	case 409:
+		return "conflict"
+	default:
+		return "error"
+	}
+}
+
+// CausalGet returns key's current clock and any unresolved siblings, for a
+// /get response to include. ok is false when the store doesn't implement
+// VersionVectorStore or key has no causal state recorded yet.
+func (ln *LeaderNode) CausalGet(key string) (clock VectorClock, siblings []Sibling, ok bool) {
+	vc, supported := ln.store.(VersionVectorStore)
+	if !supported {
+		return nil, nil, false
+	}
+	return vc.CausalGet(key)
+}
+
+// replicateToQuorum fans a mutation the leader already applied locally out
+// to every follower - a regular Write's Put, or a Txn op's Put/Delete - and
+// returns once W replicas (including the leader itself) have applied it or
+// every follower has been tried. It's the single choke point every mutating
+// path goes through, so writeQuorumWaitSeconds is timed here rather than in
+// each caller.
+func (ln *LeaderNode) replicateToQuorum(key, value string, version int, deleted bool) (int, error) {
+	start := time.Now()
+	defer func() { writeQuorumWaitSeconds.Observe(time.Since(start).Seconds()) }()
+
 	successfulWrites := 1 // Leader itself
 
-	// W=1: Only leader needs to write
+	// W=1: Only the leader needs to write
 	if ln.w == 1 {
-		return 201, version, nil
+		return 201, nil
 	}
 
-	// Replicate to followers
 	for _, followerURL := range ln.followerURLs {
-		// Simulate network delay
-		time.Sleep(200 * time.Millisecond)
+		if ln.transport == nil {
+			// Simulate the per-write TCP/HTTP overhead a real fan-out POST
+			// pays; the gRPC transport's long-lived stream doesn't, so it
+			// skips this.
+			time.Sleep(200 * time.Millisecond)
+		}
 
-		if err := ln.replicateToFollower(followerURL, key, value, version); err == nil {
+		if err := ln.replicateToFollower(followerURL, key, value, version, deleted); err == nil {
 			successfulWrites++
 
 			// Early return if W is satisfied
 			if successfulWrites >= ln.w {
-				return 201, version, nil
+				return 201, nil
 			}
+		} else {
+			// The follower missed this write - queue it for hinted
+			// handoff so it self-heals once the follower is reachable
+			// again instead of staying stale until the next write.
+			ln.queueHint(followerURL, key, value, version, deleted)
 		}
 	}
 
-	// Check if W requirement is met
 	if successfulWrites >= ln.w {
-		return 201, version, nil
+		return 201, nil
 	}
 
-	return 500, version, fmt.Errorf("failed to meet write quorum")
+	return 500, fmt.Errorf("failed to meet write quorum")
 }
 
-// replicateToFollower sends replication request to a follower
-func (ln *LeaderNode) replicateToFollower(followerURL, key, value string, version int) error {
+// replicateToFollower sends a replication request to a follower. deleted
+// marks the mutation as a tombstone (Txn's Delete op) rather than a Put;
+// value and version are ignored by the follower in that case. It goes over
+// ln.transport (REPL_TRANSPORT=grpc) when set, falling back to the
+// original JSON-over-HTTP POST to /replicate otherwise.
+func (ln *LeaderNode) replicateToFollower(followerURL, key, value string, version int, deleted bool) error {
+	if ln.transport != nil {
+		appliedAt, err := ln.transport.replicate(followerURL, key, value, version, deleted)
+		if err != nil {
+			replicationTotal.WithLabelValues(followerURL, "failure").Inc()
+			return err
+		}
+		ln.recordSafeTimestamp(followerURL, appliedAt)
+		replicationTotal.WithLabelValues(followerURL, "success").Inc()
+		return nil
+	}
+
 	payload := map[string]interface{}{
 		"key":     key,
 		"value":   value,
 		"version": version,
+		"deleted": deleted,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -138,34 +500,91 @@ func (ln *LeaderNode) replicateToFollower(followerURL, key, value string, versio
 		bytes.NewBuffer(jsonData),
 	)
 	if err != nil {
+		replicationTotal.WithLabelValues(followerURL, "failure").Inc()
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 {
+		replicationTotal.WithLabelValues(followerURL, "failure").Inc()
 		return fmt.Errorf("replication failed with status %d", resp.StatusCode)
 	}
 
+	var ack struct {
+		AppliedAt time.Time `json:"applied_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ack); err == nil {
+		ln.recordSafeTimestamp(followerURL, ack.AppliedAt)
+	}
+
+	replicationTotal.WithLabelValues(followerURL, "success").Inc()
 	return nil
 }
 
-// Read performs a read operation
-func (ln *LeaderNode) Read(key string) (int, string, int, error) {
+// recordSafeTimestamp folds a follower's gossiped applied-at time into its
+// safe timestamp, which only ever moves forward (acks can arrive out of
+// order under concurrent replication).
+func (ln *LeaderNode) recordSafeTimestamp(followerURL string, appliedAt time.Time) {
+	if appliedAt.IsZero() {
+		return
+	}
+	ln.safeTimestampsMu.Lock()
+	defer ln.safeTimestampsMu.Unlock()
+	if appliedAt.After(ln.safeTimestamps[followerURL]) {
+		ln.safeTimestamps[followerURL] = appliedAt
+	}
+}
+
+// freshestFollowers returns followerURLs ordered by descending gossiped
+// safe timestamp, so a bounded/eventual read tries the replica most likely
+// to satisfy it first instead of guessing.
+func (ln *LeaderNode) freshestFollowers() []string {
+	ln.safeTimestampsMu.RLock()
+	defer ln.safeTimestampsMu.RUnlock()
+
+	urls := append([]string(nil), ln.followerURLs...)
+	sort.Slice(urls, func(i, j int) bool {
+		return ln.safeTimestamps[urls[i]].After(ln.safeTimestamps[urls[j]])
+	})
+	return urls
+}
+
+// Read performs a read operation. consistency selects how it's allowed to
+// answer: ConsistencyStrong always does the existing R-quorum read;
+// ConsistencyBounded and ConsistencyEventual first try to answer from a
+// single replica (staleness is only checked for ConsistencyBounded) and
+// only fall back to the quorum read if no replica qualifies.
+func (ln *LeaderNode) Read(key string, consistency ReadConsistency, staleness time.Duration) (int, string, int, error) {
+	readsTotal.WithLabelValues("leader").Inc()
+
+	if consistency == ConsistencyBounded || consistency == ConsistencyEventual {
+		if status, value, version, ok := ln.readFromFreshReplica(key, consistency, staleness); ok {
+			return status, value, version, nil
+		}
+		// No replica qualified (or none is reachable) - fall through to
+		// the quorum read below, same as ConsistencyStrong.
+	}
+
 	// R=1: Only read from leader
 	if ln.r == 1 {
-		pair, exists := ln.kvStore.Get(key)
-		if !exists {
+		pair, exists, err := ln.store.Get(key)
+		if err != nil {
+			return 500, "", 0, err
+		}
+		if !exists || pair.Deleted {
 			return 404, "", 0, fmt.Errorf("key not found")
 		}
 		return 200, pair.Value, pair.Version, nil
 	}
 
-	// R>1: Read from multiple nodes and return latest version
-	results := []KVPair{}
+	// R>1: Read from multiple nodes and return latest version. readResult
+	// tracks which followerURL produced each result ("" for the leader
+	// itself) so a post-read repair pass knows who to push the winner to.
+	results := []readResult{}
 
 	// Read from leader
-	if pair, exists := ln.kvStore.Get(key); exists {
-		results = append(results, pair)
+	if pair, exists, err := ln.store.Get(key); err == nil && exists {
+		results = append(results, readResult{pair: pair})
 	}
 
 	// Read from followers
@@ -176,7 +595,7 @@ func (ln *LeaderNode) Read(key string) (int, string, int, error) {
 		}
 
 		if pair, err := ln.readFromFollower(followerURL, key); err == nil {
-			results = append(results, pair)
+			results = append(results, readResult{followerURL: followerURL, pair: pair})
 			nodesRead++
 		}
 	}
@@ -191,16 +610,132 @@ func (ln *LeaderNode) Read(key string) (int, string, int, error) {
 		return 404, "", 0, fmt.Errorf("key not found")
 	}
 
-	latest := results[0]
-	for _, pair := range results {
-		if pair.Version > latest.Version {
-			latest = pair
+	latest := results[0].pair
+	for _, r := range results {
+		if r.pair.Version > latest.Version {
+			latest = r.pair
 		}
 	}
 
+	if ln.r > 1 {
+		go ln.readRepair(key, latest, results)
+	}
+
+	if latest.Deleted {
+		return 404, "", 0, fmt.Errorf("key not found")
+	}
 	return 200, latest.Value, latest.Version, nil
 }
 
+// readResult is one replica's answer to a quorum Read, tagged with which
+// follower produced it ("" for the leader's own store) so readRepair knows
+// where to push a winning value a replica is missing.
+type readResult struct {
+	followerURL string
+	pair        KVPair
+}
+
+// readRepair pushes latest to every replica in results whose version
+// disagrees with it, so a quorum read that noticed a lagging replica fixes
+// it without waiting for that key's next write. It runs in the background
+// after Read returns, so it never adds latency to the client-facing
+// request.
+func (ln *LeaderNode) readRepair(key string, latest KVPair, results []readResult) {
+	for _, r := range results {
+		if r.pair.Version >= latest.Version {
+			continue
+		}
+		if r.followerURL == "" {
+			continue // the leader's own copy is always in results at its current version
+		}
+		if err := ln.replicateToFollower(r.followerURL, key, latest.Value, latest.Version, latest.Deleted); err != nil {
+			logger.Warn("read repair: failed to push value", "key", key, "peer", r.followerURL, "error", err)
+			continue
+		}
+		readRepairsTotal.WithLabelValues(r.followerURL).Inc()
+	}
+}
+
+// readFromFreshReplica tries to answer a bounded-staleness or eventual read
+// directly from a single replica (leader first, then followers ordered by
+// gossiped freshness), skipping the R-quorum round trip. ok is false when
+// no replica could satisfy the request, meaning the caller should fall back
+// to a quorum read.
+func (ln *LeaderNode) readFromFreshReplica(key string, consistency ReadConsistency, staleness time.Duration) (status int, value string, version int, ok bool) {
+	qualifies := func(pair KVPair, exists bool) bool {
+		if !exists {
+			return false
+		}
+		if consistency == ConsistencyBounded && time.Since(pair.AppliedAt) > staleness {
+			return false
+		}
+		return true
+	}
+	answer := func(pair KVPair) (int, string, int, bool) {
+		if pair.Deleted {
+			return 404, "", 0, true
+		}
+		return 200, pair.Value, pair.Version, true
+	}
+
+	if pair, exists, err := ln.store.Get(key); err == nil && qualifies(pair, exists) {
+		return answer(pair)
+	}
+
+	for _, followerURL := range ln.freshestFollowers() {
+		if consistency == ConsistencyBounded {
+			ln.safeTimestampsMu.RLock()
+			safe := ln.safeTimestamps[followerURL]
+			ln.safeTimestampsMu.RUnlock()
+			if safe.IsZero() || time.Since(safe) > staleness {
+				continue // gossip already says this follower can't qualify
+			}
+		}
+
+		pair, err := ln.readFromFollower(followerURL, key)
+		if err != nil {
+			continue
+		}
+		if qualifies(pair, true) {
+			return answer(pair)
+		}
+	}
+
+	return 0, "", 0, false
+}
+
+// replicationLagHeartbeatKey is the key RunReplicationLagProbe writes on the
+// leader and then reads back from each follower's /local_read, so it has an
+// AppliedAt to diff against without touching any real client key.
+const replicationLagHeartbeatKey = "__replication_lag_heartbeat__"
+
+// RunReplicationLagProbe periodically writes a heartbeat key on the leader
+// and reads it back from every follower, setting replicationLagSeconds to
+// how far behind each follower's AppliedAt is from the write it just saw.
+// Unlike replicationLagVersions (which only moves when a real write lands
+// out of order), this gives a continuous per-follower freshness signal even
+// on an idle cluster. It never returns; callers start it with `go`.
+func (ln *LeaderNode) RunReplicationLagProbe(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		beat := time.Now()
+		if _, err := ln.store.Set(replicationLagHeartbeatKey, beat.Format(time.RFC3339Nano), nil); err != nil {
+			logger.Error("replication lag probe: failed to write heartbeat", "error", err)
+			continue
+		}
+
+		for _, followerURL := range ln.followerURLs {
+			pair, err := ln.readFromFollower(followerURL, replicationLagHeartbeatKey)
+			if err != nil {
+				logger.Warn("replication lag probe: follower unreachable", "peer", followerURL, "error", err)
+				continue
+			}
+			replicationLagSeconds.WithLabelValues(followerURL).Set(time.Since(pair.AppliedAt).Seconds())
+		}
+	}
+}
+
 // readFromFollower reads from a follower node
 func (ln *LeaderNode) readFromFollower(followerURL, key string) (KVPair, error) {
 	resp, err := http.Get(followerURL + "/local_read/" + key)
@@ -214,55 +749,277 @@ func (ln *LeaderNode) readFromFollower(followerURL, key string) (KVPair, error)
 	}
 
 	var result struct {
-		Value   string `json:"value"`
-		Version int    `json:"version"`
+		Value     string    `json:"value"`
+		Version   int       `json:"version"`
+		Deleted   bool      `json:"deleted"`
+		AppliedAt time.Time `json:"applied_at"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return KVPair{}, err
 	}
 
-	return KVPair{Value: result.Value, Version: result.Version}, nil
+	return KVPair{Value: result.Value, Version: result.Version, Deleted: result.Deleted, AppliedAt: result.AppliedAt}, nil
 }
 
-// LocalRead performs a local read (for testing)
-func (ln *LeaderNode) LocalRead(key string) (int, string, int, error) {
-	pair, exists := ln.kvStore.Get(key)
+// LocalRead performs a local read (for testing). Unlike Read, it does not
+// mask tombstones as 404: replication and quorum reads need to see a
+// deleted pair's version so a late-arriving write at an older version
+// doesn't resurrect it. It also reports AppliedAt so a bounded-staleness
+// read on another node can decide whether this replica is fresh enough.
+func (ln *LeaderNode) LocalRead(key string) (int, string, int, bool, time.Time, error) {
+	readsTotal.WithLabelValues("local").Inc()
+
+	pair, exists, err := ln.store.Get(key)
+	if err != nil {
+		return 500, "", 0, false, time.Time{}, err
+	}
 	if !exists {
-		return 404, "", 0, fmt.Errorf("key not found")
+		return 404, "", 0, false, time.Time{}, fmt.Errorf("key not found")
+	}
+	return 200, pair.Value, pair.Version, pair.Deleted, pair.AppliedAt, nil
+}
+
+// TxnCompare is one predicate in a Txn's compare list, modeled on etcd's
+// compare-and-swap. Exactly one of ExpectedVersion/ExpectedValue/Exists
+// should be set; Key is evaluated against the leader's local store.
+type TxnCompare struct {
+	Key             string  `json:"key"`
+	ExpectedVersion *int    `json:"expected_version,omitempty"`
+	ExpectedValue   *string `json:"expected_value,omitempty"`
+	// Exists checks for key presence/absence; a tombstoned key counts as
+	// absent, the same way LeaderNode.Read masks tombstones as 404.
+	Exists *bool `json:"exists,omitempty"`
+}
+
+// TxnOp is one operation in a Txn's then/else branch. Exactly one of
+// Put/Delete/Get must be set.
+type TxnOp struct {
+	Put    *TxnPut    `json:"put,omitempty"`
+	Delete *TxnDelete `json:"delete,omitempty"`
+	Get    *TxnGet    `json:"get,omitempty"`
+}
+
+// TxnPut sets Key to Value, the same as a regular Write.
+type TxnPut struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// TxnDelete tombstones Key, the same as Store.Delete.
+type TxnDelete struct {
+	Key string `json:"key"`
+}
+
+// TxnGet reads Key's current value without mutating it.
+type TxnGet struct {
+	Key string `json:"key"`
+}
+
+// TxnOpResult is one op's outcome, in the same order as the ops in the
+// branch that ran.
+type TxnOpResult struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// TxnRequest is a compare-and-swap transaction: if every Compare holds,
+// Then runs; otherwise Else runs.
+type TxnRequest struct {
+	Compares []TxnCompare `json:"compares"`
+	Then     []TxnOp      `json:"then"`
+	Else     []TxnOp      `json:"else"`
+}
+
+// TxnResponse reports which branch ran and that branch's op results, in
+// the same shape etcd's KV.Txn returns.
+type TxnResponse struct {
+	Succeeded bool          `json:"succeeded"`
+	Responses []TxnOpResult `json:"responses"`
+}
+
+// Txn evaluates req's compares against the leader's local store under
+// txnMu (the shard mutex that keeps a concurrent Txn from reading a
+// version this one is about to invalidate), applies the chosen branch's
+// ops locally, and replicates each mutating op to followers under the
+// existing W-quorum rules before returning. Because ops replicate
+// one-by-one rather than as a single atomic batch, a quorum failure partway
+// through a multi-op branch can leave it partially applied - callers that
+// need all-or-nothing semantics across multiple keys should keep each Txn
+// to a single mutating op.
+func (ln *LeaderNode) Txn(req TxnRequest) (TxnResponse, error) {
+	ln.txnMu.Lock()
+	defer ln.txnMu.Unlock()
+
+	succeeded := true
+	for _, cmp := range req.Compares {
+		if !ln.evaluateCompare(cmp) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := req.Then
+	if !succeeded {
+		ops = req.Else
+	}
+
+	responses := make([]TxnOpResult, 0, len(ops))
+	for _, op := range ops {
+		result, err := ln.applyTxnOp(op)
+		if err != nil {
+			return TxnResponse{}, err
+		}
+		responses = append(responses, result)
+	}
+
+	return TxnResponse{Succeeded: succeeded, Responses: responses}, nil
+}
+
+// evaluateCompare checks a single TxnCompare against the local store.
+func (ln *LeaderNode) evaluateCompare(cmp TxnCompare) bool {
+	pair, rawExists, err := ln.store.Get(cmp.Key)
+	if err != nil {
+		return false
+	}
+	exists := rawExists && !pair.Deleted
+
+	if cmp.Exists != nil && exists != *cmp.Exists {
+		return false
+	}
+	if cmp.ExpectedVersion != nil && (!exists || pair.Version != *cmp.ExpectedVersion) {
+		return false
+	}
+	if cmp.ExpectedValue != nil && (!exists || pair.Value != *cmp.ExpectedValue) {
+		return false
+	}
+	return true
+}
+
+// applyTxnOp applies a single op to the local store and, for a mutating op,
+// replicates it to followers under the existing W-quorum rules before
+// returning.
+func (ln *LeaderNode) applyTxnOp(op TxnOp) (TxnOpResult, error) {
+	switch {
+	case op.Put != nil:
+		version, err := ln.store.Set(op.Put.Key, op.Put.Value, nil)
+		if err != nil {
+			writesTotal.WithLabelValues("error").Inc()
+			return TxnOpResult{}, err
+		}
+		if _, err := ln.replicateToQuorum(op.Put.Key, op.Put.Value, version, false); err != nil {
+			writesTotal.WithLabelValues("error").Inc()
+			return TxnOpResult{}, err
+		}
+		writesTotal.WithLabelValues("success").Inc()
+		return TxnOpResult{Key: op.Put.Key, Value: op.Put.Value, Version: version}, nil
+
+	case op.Delete != nil:
+		if err := ln.store.Delete(op.Delete.Key); err != nil {
+			writesTotal.WithLabelValues("error").Inc()
+			return TxnOpResult{}, err
+		}
+		pair, _, err := ln.store.Get(op.Delete.Key)
+		if err != nil {
+			writesTotal.WithLabelValues("error").Inc()
+			return TxnOpResult{}, err
+		}
+		if _, err := ln.replicateToQuorum(op.Delete.Key, "", pair.Version, true); err != nil {
+			writesTotal.WithLabelValues("error").Inc()
+			return TxnOpResult{}, err
+		}
+		writesTotal.WithLabelValues("success").Inc()
+		return TxnOpResult{Key: op.Delete.Key, Deleted: true, Version: pair.Version}, nil
+
+	case op.Get != nil:
+		pair, exists, err := ln.store.Get(op.Get.Key)
+		if err != nil {
+			return TxnOpResult{}, err
+		}
+		if !exists || pair.Deleted {
+			return TxnOpResult{Key: op.Get.Key}, nil
+		}
+		return TxnOpResult{Key: op.Get.Key, Value: pair.Value, Version: pair.Version}, nil
+
+	default:
+		return TxnOpResult{}, fmt.Errorf("txn op must set exactly one of put, delete, or get")
 	}
-	return 200, pair.Value, pair.Version, nil
 }
 
 // FollowerNode represents a follower in the Leader-Follower architecture
 type FollowerNode struct {
-	kvStore *KVStore
+	store Store
 }
 
 // NewFollowerNode creates a new follower node
-func NewFollowerNode() *FollowerNode {
+func NewFollowerNode(store Store) *FollowerNode {
 	return &FollowerNode{
-		kvStore: NewKVStore(),
+		store: store,
 	}
 }
 
-// Replicate handles replication request from leader
-func (fn *FollowerNode) Replicate(key, value string, version int) int {
+// Replicate handles a replication request from the leader: a normal Put, or
+// a tombstone when deleted is true (a Txn Delete op replicated here, same
+// as a regular write). The returned time is this follower's AppliedAt for
+// the mutation, piggybacked on the ack so the leader can gossip a
+// per-follower safe timestamp for bounded-staleness reads without a
+// separate round trip.
+func (fn *FollowerNode) Replicate(key, value string, version int, deleted bool) (int, time.Time) {
 	// Simulate write delay
 	time.Sleep(100 * time.Millisecond)
 
-	fn.kvStore.Set(key, value, &version)
-	return 201
+	if deleted {
+		if err := fn.store.Delete(key); err != nil {
+			return 500, time.Time{}
+		}
+		pair, _, err := fn.store.Get(key)
+		if err != nil {
+			return 500, time.Time{}
+		}
+		return 201, pair.AppliedAt
+	}
+
+	// A gap above 0 means one or more versions never reached this
+	// follower before this one did - worth alerting on even though the
+	// write itself still succeeds.
+	if existing, exists, err := fn.store.Get(key); err == nil && exists {
+		lag := version - existing.Version - 1
+		if lag < 0 {
+			lag = 0
+		}
+		replicationLagVersions.WithLabelValues("leader").Set(float64(lag))
+	}
+
+	if _, err := fn.store.Set(key, value, &version); err != nil {
+		return 500, time.Time{}
+	}
+
+	pair, _, err := fn.store.Get(key)
+	if err != nil {
+		return 500, time.Time{}
+	}
+	return 201, pair.AppliedAt
 }
 
-// LocalRead performs a local read
-func (fn *FollowerNode) LocalRead(key string) (int, string, int, error) {
+// LocalRead performs a local read. It does not mask tombstones as 404, for
+// the same reason LeaderNode.LocalRead doesn't: the leader's quorum read
+// needs to compare versions across replicas including deleted ones. It also
+// reports AppliedAt so the leader's bounded-staleness reads can tell
+// whether this follower is fresh enough.
+func (fn *FollowerNode) LocalRead(key string) (int, string, int, bool, time.Time, error) {
+	readsTotal.WithLabelValues("local").Inc()
+
 	// Simulate read delay
 	time.Sleep(50 * time.Millisecond)
 
-	pair, exists := fn.kvStore.Get(key)
+	pair, exists, err := fn.store.Get(key)
+	if err != nil {
+		return 500, "", 0, false, time.Time{}, err
+	}
 	if !exists {
-		return 404, "", 0, fmt.Errorf("key not found")
+		return 404, "", 0, false, time.Time{}, fmt.Errorf("key not found")
 	}
-	return 200, pair.Value, pair.Version, nil
+	return 200, pair.Value, pair.Version, pair.Deleted, pair.AppliedAt, nil
 }
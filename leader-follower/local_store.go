@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const localBucketName = "kv"
+
+func init() {
+	RegisterDriver("local", func(cfg json.RawMessage) (Store, error) {
+		var opts struct {
+			Path string `json:"path"`
+		}
+		if len(cfg) > 0 {
+			if err := json.Unmarshal(cfg, &opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Path == "" {
+			opts.Path = os.Getenv("LOCAL_STORE_PATH")
+		}
+		if opts.Path == "" {
+			opts.Path = "data.db"
+		}
+		return NewLocalStore(opts.Path)
+	})
+}
+
+// LocalStore implements the Store interface using a local BoltDB file,
+// giving single-node durability without depending on S3.
+type LocalStore struct {
+	db *bolt.DB
+	watchHub
+}
+
+// NewLocalStore opens (creating if necessary) a BoltDB file at path.
+func NewLocalStore(path string) (*LocalStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(localBucketName))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &LocalStore{db: db}, nil
+}
+
+// Set stores a key-value pair with optional version. A nil version becomes
+// the key's existing version plus one (1 for a new key).
+func (l *LocalStore) Set(key, value string, version *int) (int, error) {
+	var v int
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(localBucketName))
+
+		if version == nil {
+			existing, ok, err := getPair(b, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				v = existing.Version + 1
+			} else {
+				v = 1
+			}
+		} else {
+			v = *version
+		}
+
+		data, err := json.Marshal(KVPair{Value: value, Version: v, AppliedAt: time.Now()})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	if err != nil {
+		return 0, err
+	}
+	l.notify(Event{Key: key, Value: value, Version: v})
+	return v, nil
+}
+
+// Get retrieves a key-value pair
+func (l *LocalStore) Get(key string) (KVPair, bool, error) {
+	var pair KVPair
+	var found bool
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(localBucketName))
+		p, ok, err := getPair(b, key)
+		if err != nil {
+			return err
+		}
+		pair, found = p, ok
+		return nil
+	})
+	return pair, found, err
+}
+
+// SetReader drains r and stores it the same way Set does; BoltDB needs the
+// full value to write a single record, so this doesn't avoid buffering, but
+// it keeps LocalStore a drop-in for the streaming interface.
+func (l *LocalStore) SetReader(key string, r io.Reader, version *int) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return l.Set(key, string(data), version)
+}
+
+// GetReader wraps the stored value in a no-op ReadCloser.
+func (l *LocalStore) GetReader(key string) (io.ReadCloser, KVPair, bool, error) {
+	pair, exists, err := l.Get(key)
+	if err != nil || !exists {
+		return nil, pair, exists, err
+	}
+	return io.NopCloser(strings.NewReader(pair.Value)), pair, true, nil
+}
+
+// Delete writes a tombstone over the existing pair rather than removing it;
+// see the Store.Delete doc comment for why.
+func (l *LocalStore) Delete(key string) error {
+	var pair KVPair
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(localBucketName))
+		p, _, err := getPair(b, key)
+		if err != nil {
+			return err
+		}
+		p.Version++
+		p.Deleted = true
+		p.DeletedAt = time.Now()
+		p.AppliedAt = time.Now()
+		pair = p
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	if err != nil {
+		return err
+	}
+	l.notify(Event{Key: key, Version: pair.Version, Deleted: true})
+	return nil
+}
+
+// Untrash clears a tombstone, restoring the value it shadowed, as long as
+// it is still within TrashLifetime.
+func (l *LocalStore) Untrash(key string) error {
+	var pair KVPair
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(localBucketName))
+		p, exists, err := getPair(b, key)
+		if err != nil {
+			return err
+		}
+		if !exists || !p.Deleted {
+			return fmt.Errorf("key %q has no tombstone to restore", key)
+		}
+		if time.Since(p.DeletedAt) > TrashLifetime {
+			return fmt.Errorf("key %q tombstone is past its trash lifetime", key)
+		}
+
+		p.Version++
+		p.Deleted = false
+		p.DeletedAt = time.Time{}
+		p.AppliedAt = time.Now()
+		pair = p
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	if err != nil {
+		return err
+	}
+	l.notify(Event{Key: key, Value: pair.Value, Version: pair.Version})
+	return nil
+}
+
+// HardDelete physically removes a key, tombstoned or not. It's used by the
+// trash sweeper once a tombstone has aged past TrashLifetime.
+func (l *LocalStore) HardDelete(key string) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(localBucketName)).Delete([]byte(key))
+	})
+}
+
+// Watch subscribes to changes on key via the shared in-process watchHub.
+func (l *LocalStore) Watch(key string) (<-chan Event, func(), error) {
+	return l.watch(key)
+}
+
+// List returns every key currently held
+func (l *LocalStore) List() ([]string, error) {
+	var keys []string
+	err := l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(localBucketName)).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// HealthCheck verifies the underlying BoltDB file is still usable
+func (l *LocalStore) HealthCheck() error {
+	return l.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(localBucketName)) == nil {
+			return fmt.Errorf("local store bucket missing")
+		}
+		return nil
+	})
+}
+
+func getPair(b *bolt.Bucket, key string) (KVPair, bool, error) {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return KVPair{}, false, nil
+	}
+	var pair KVPair
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return KVPair{}, false, err
+	}
+	return pair, true, nil
+}
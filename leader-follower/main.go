@@ -1,59 +1,68 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// createStore creates a Store based on BACKEND_TYPE environment variable
-// Returns: memory store if BACKEND_TYPE=memory or not set
-//
-//	S3 store if BACKEND_TYPE=s3
+// trashSweepInterval is how often RunTrashSweeper scans for tombstones that
+// have aged past TrashLifetime.
+const trashSweepInterval = time.Hour
+
+// hintedHandoffInterval is how often RunHintedHandoff checks whether a
+// follower with queued hints is reachable again.
+const hintedHandoffInterval = 5 * time.Second
+
+// replicationLagProbeInterval is how often RunReplicationLagProbe writes its
+// heartbeat key and measures each follower's replication lag.
+const replicationLagProbeInterval = 5 * time.Second
+
+// createStore builds a Store by looking up BACKEND_TYPE in the driver
+// registry, so a node can be backed by memory, a local BoltDB file, S3,
+// etcd, or Consul purely via config without any code changes. Per-node
+// driver options are read from DRIVER_CONFIG (a JSON object) when set,
+// falling back to legacy env vars (S3_BUCKET, LOCAL_STORE_PATH,
+// ETCD_ENDPOINTS, CONSUL_ADDR) for backward compatibility.
 func createStore() (Store, error) {
 	backendType := os.Getenv("BACKEND_TYPE")
 	if backendType == "" {
 		backendType = "memory" // default to memory
 	}
 
-	log.Println("=== createStore() invoked ===")
-	log.Println("BACKEND_TYPE =", backendType)
-	log.Println("S3_BUCKET =", os.Getenv("S3_BUCKET"))
-	log.Println("S3_ENDPOINT =", os.Getenv("S3_ENDPOINT"))
+	logger.Info("createStore invoked", "backend_type", backendType)
 
-	switch backendType {
-	case "s3":
-		bucket := os.Getenv("S3_BUCKET")
-		if bucket == "" {
-			return nil, fmt.Errorf("S3_BUCKET missing when BACKEND_TYPE=s3")
-		}
-		store, err := NewS3Store(bucket)
-		if err != nil {
-			return nil, err
-		}
-		log.Printf("Using S3 backend (bucket: %s)", bucket)
-		return store, nil
+	var cfg json.RawMessage
+	if raw := os.Getenv("DRIVER_CONFIG"); raw != "" {
+		cfg = json.RawMessage(raw)
+	}
 
-	case "memory":
-		fallthrough
-	default:
-		log.Printf("Using in-memory backend")
-		return NewKVStore(), nil
+	store, err := NewStore(backendType, cfg)
+	if err != nil {
+		return nil, err
 	}
+	logger.Info("using backend", "backend_type", backendType)
+	return store, nil
 }
 
 func main() {
-	nodeType := os.Getenv("NODE_TYPE") // "leader" or "follower"
+	nodeType := os.Getenv("NODE_TYPE") // "leader", "follower", or "raft"
 	if nodeType == "" {
 		nodeType = "follower"
 	}
+	if os.Getenv("CONSENSUS") == "raft" {
+		nodeType = "raft"
+	}
 
 	store, err := createStore()
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("failed to create store", "error", err)
+		os.Exit(1)
 	}
+	go RunTrashSweeper(store, trashSweepInterval)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -72,22 +81,84 @@ func main() {
 
 	var server *Server
 
-	if nodeType == "leader" {
+	switch nodeType {
+	case "raft":
+		nodeID := os.Getenv("NODE_ID")
+		if nodeID == "" {
+			logger.Error("NODE_ID is required when CONSENSUS=raft")
+			os.Exit(1)
+		}
+		raftAddr := os.Getenv("RAFT_ADDR")
+		if raftAddr == "" {
+			raftAddr = "127.0.0.1:7000"
+		}
+		httpAddr := os.Getenv("HTTP_ADDR")
+		if httpAddr == "" {
+			httpAddr = "http://localhost:" + port
+		}
+		raftDataDir := os.Getenv("RAFT_DATA_DIR")
+		if raftDataDir == "" {
+			raftDataDir = filepath.Join("data", "raft", nodeID)
+		}
+		bootstrap := os.Getenv("RAFT_BOOTSTRAP") == "true"
+
+		raftNode, err := NewRaftNode(nodeID, raftAddr, httpAddr, raftDataDir, store, bootstrap)
+		if err != nil {
+			logger.Error("failed to start raft node", "error", err)
+			os.Exit(1)
+		}
+		server = NewServer(port, nil, nil, raftNode, nodeType)
+
+	case "leader":
 		// Parse follower URLs from environment
 		followerURLs := []string{}
 		if urls := os.Getenv("FOLLOWER_URLS"); urls != "" {
 			followerURLs = strings.Split(urls, ",")
 		}
 
-		leader := NewLeaderNode(store, followerURLs, w, r)
-		server = NewServer(port, leader, nil, nodeType)
-	} else {
+		nodeID := os.Getenv("NODE_ID")
+		if nodeID == "" {
+			nodeID = "leader"
+		}
+
+		tlsConfig, err := buildReplTLSConfig()
+		if err != nil {
+			logger.Error("failed to build replication TLS config", "error", err)
+			os.Exit(1)
+		}
+
+		var transport replTransport
+		if os.Getenv("REPL_TRANSPORT") == "grpc" {
+			transport = newGRPCReplTransport(tlsConfig)
+			// The leader itself never accepts Apply (nothing replicates
+			// to it), but it still serves Snapshot so a new follower can
+			// bootstrap from its store.
+			go RunGRPCReplicationServer(replGRPCAddr(), store, nil, tlsConfig)
+		}
+
+		leader := NewLeaderNode(store, followerURLs, w, r, nodeID, transport)
+		go leader.RunHintedHandoff(hintedHandoffInterval)
+		go leader.RunReplicationLagProbe(replicationLagProbeInterval)
+		server = NewServer(port, leader, nil, nil, nodeType)
+
+	default:
 		follower := NewFollowerNode(store)
-		server = NewServer(port, nil, follower, nodeType)
+
+		if os.Getenv("REPL_TRANSPORT") == "grpc" {
+			tlsConfig, err := buildReplTLSConfig()
+			if err != nil {
+				logger.Error("failed to build replication TLS config", "error", err)
+				os.Exit(1)
+			}
+			go RunGRPCReplicationServer(replGRPCAddr(), store, followerApplyFunc(follower), tlsConfig)
+		}
+
+		server = NewServer(port, nil, follower, nil, nodeType)
 	}
 
-	log.Printf("Starting %s node on port %s (W=%d, R=%d)\n", nodeType, port, w, r)
+	logger.Info("starting node", "node_type", nodeType, "port", port, "w", w, "r", r)
 	if err := server.Start(); err != nil {
-		log.Fatal(err)
+		logger.Error("server exited", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+)
+
+// raftCommand is one entry in the Raft log: either a Put (Set) or a Delete,
+// applied to the local Store once a majority of the cluster has persisted
+// it.
+type raftCommand struct {
+	Op    string `json:"op"` // "set" or "delete"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// raftApplyResult is what Apply returns through the raft.Log's future, so
+// RaftNode.Set/Delete can hand the caller back the version Store assigned
+// without a second round trip to the store.
+type raftApplyResult struct {
+	version int
+	err     error
+}
+
+// raftFSM bridges Raft's replicated log to the existing Store interface:
+// every committed log entry is applied to store on every node, so all
+// replicas converge on the same state without the leader-follower layer's
+// HTTP fan-out.
+type raftFSM struct {
+	store Store
+}
+
+// Apply applies one committed log entry to the local store. A decode
+// failure here means the log itself is corrupt, which every node will hit
+// identically - there's no good recovery short of panicking.
+func (f *raftFSM) Apply(entry *raft.Log) interface{} {
+	var cmd raftCommand
+	if err := json.Unmarshal(entry.Data, &cmd); err != nil {
+		panic(fmt.Sprintf("raft fsm: corrupt log entry: %v", err))
+	}
+
+	switch cmd.Op {
+	case "set":
+		version, err := f.store.Set(cmd.Key, cmd.Value, nil)
+		return raftApplyResult{version: version, err: err}
+	case "delete":
+		err := f.store.Delete(cmd.Key)
+		return raftApplyResult{err: err}
+	default:
+		panic(fmt.Sprintf("raft fsm: unknown op %q", cmd.Op))
+	}
+}
+
+// Snapshot captures the store's full state for Raft's log compaction,
+// reusing Store.List/Get rather than requiring a separate snapshot format
+// per backend.
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	keys, err := f.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make(map[string]KVPair, len(keys))
+	for _, key := range keys {
+		pair, exists, err := f.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			pairs[key] = pair
+		}
+	}
+	return &raftFSMSnapshot{pairs: pairs}, nil
+}
+
+// Restore writes a previously captured snapshot's live pairs into the
+// store at their snapshotted versions, called on startup when Raft has a
+// snapshot newer than what's in the log this node has locally (e.g. it was
+// down long enough to fall behind the log's retention). Tombstoned pairs in
+// the snapshot are skipped, and keys the store already holds that the
+// snapshot lacks are left in place rather than removed.
+func (f *raftFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var pairs map[string]KVPair
+	if err := json.NewDecoder(rc).Decode(&pairs); err != nil {
+		return err
+	}
+
+	for key, pair := range pairs {
+		if pair.Deleted {
+			continue
+		}
+		version := pair.Version
+		if _, err := f.store.Set(key, pair.Value, &version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raftFSMSnapshot is the in-flight snapshot raft.Raft persists via the
+// configured SnapshotStore.
+type raftFSMSnapshot struct {
+	pairs map[string]KVPair
+}
+
+func (s *raftFSMSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(s.pairs); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *raftFSMSnapshot) Release() {}
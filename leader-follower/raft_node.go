@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+// ErrNotLeader is returned by RaftNode's write path and cluster-membership
+// methods when called on a node that isn't the current Raft leader -
+// callers should redirect the client to Leader() the same way etcd's client
+// retries a write against whichever node it reports.
+var ErrNotLeader = errors.New("not the raft leader")
+
+// RaftNode runs a Raft-replicated log across the cluster in place of the
+// leader-follower layer's static W/R quorum over HTTP fan-out: every
+// Set/Delete is appended as a log entry and only applied to Store once a
+// majority of nodes have persisted it, giving linearizable writes and
+// automatic leader election on failure.
+type RaftNode struct {
+	raft  *raft.Raft
+	store Store
+
+	mu        sync.RWMutex
+	httpAddrs map[raft.ServerAddress]string // raft transport address -> HTTP API address
+}
+
+// NewRaftNode starts (or rejoins) a Raft node. nodeID must be unique
+// cluster-wide; raftAddr is the host:port Raft uses for its own replication
+// traffic, separate from the HTTP API port; httpAddr is this node's own
+// HTTP API address, handed to the leader via /cluster/join so Leader() can
+// report an address clients can actually reach; dataDir holds the Raft
+// log, stable store, and snapshots; bootstrap is true only for the node
+// that starts a brand-new cluster - every other node joins via
+// /cluster/join instead.
+func NewRaftNode(nodeID, raftAddr, httpAddr, dataDir string, store Store, bootstrap bool) (*RaftNode, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(nodeID)
+
+	addr, err := net.ResolveTCPAddr("tcp", raftAddr)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(raftAddr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(dataDir, 2, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(dataDir, "raft-log.db"))
+	if err != nil {
+		return nil, err
+	}
+	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(dataDir, "raft-stable.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	fsm := &raftFSM{store: store}
+
+	r, err := raft.NewRaft(config, fsm, logStore, stableStore, snapshots, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	if bootstrap {
+		future := r.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{ID: config.LocalID, Address: transport.LocalAddr()},
+			},
+		})
+		if err := future.Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	rn := &RaftNode{
+		raft:      r,
+		store:     store,
+		httpAddrs: map[raft.ServerAddress]string{transport.LocalAddr(): httpAddr},
+	}
+	return rn, nil
+}
+
+// Set appends a "set" command to the Raft log and waits for it to be
+// applied, returning ErrNotLeader if this node isn't currently the leader.
+func (rn *RaftNode) Set(key, value string) (int, error) {
+	result, err := rn.apply(raftCommand{Op: "set", Key: key, Value: value})
+	if err != nil {
+		return 0, err
+	}
+	return result.version, result.err
+}
+
+// Delete appends a "delete" command to the Raft log and waits for it to be
+// applied.
+func (rn *RaftNode) Delete(key string) error {
+	result, err := rn.apply(raftCommand{Op: "delete", Key: key})
+	if err != nil {
+		return err
+	}
+	return result.err
+}
+
+// apply submits cmd to the Raft log and blocks until it's been committed
+// and applied to this node's FSM.
+func (rn *RaftNode) apply(cmd raftCommand) (raftApplyResult, error) {
+	if rn.raft.State() != raft.Leader {
+		return raftApplyResult{}, ErrNotLeader
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return raftApplyResult{}, err
+	}
+
+	future := rn.raft.Apply(data, 10*time.Second)
+	if err := future.Error(); err != nil {
+		return raftApplyResult{}, err
+	}
+
+	result, ok := future.Response().(raftApplyResult)
+	if !ok {
+		return raftApplyResult{}, fmt.Errorf("raft: unexpected apply response type %T", future.Response())
+	}
+	return result, nil
+}
+
+// LinearizableRead confirms this node is still the leader (via Raft's
+// read-index/leader-lease check) before reading locally, so a leader that's
+// already lost an election to a newer term can't serve a read based on data
+// a new leader has since overwritten.
+func (rn *RaftNode) LinearizableRead(key string) (int, string, int, bool, error) {
+	if err := rn.raft.VerifyLeader().Error(); err != nil {
+		return 0, "", 0, false, ErrNotLeader
+	}
+	return rn.localRead(key)
+}
+
+// StaleRead serves key from this node's local Store without confirming
+// leadership, trading a possibly-stale result for a read that never leaves
+// this node - the raft-mode analogue of the existing local_read path.
+func (rn *RaftNode) StaleRead(key string) (int, string, int, bool, error) {
+	return rn.localRead(key)
+}
+
+func (rn *RaftNode) localRead(key string) (int, string, int, bool, error) {
+	pair, exists, err := rn.store.Get(key)
+	if err != nil {
+		return 500, "", 0, false, err
+	}
+	if !exists || pair.Deleted {
+		return 404, "", 0, false, fmt.Errorf("key not found")
+	}
+	return 200, pair.Value, pair.Version, pair.Deleted, nil
+}
+
+// Join adds nodeID (reachable at raftAddr for Raft traffic, httpAddr for its
+// HTTP API) to the cluster as a voter. Only the current leader can do this.
+// httpAddr is recorded regardless of whether AddVoter succeeds, so a
+// subsequent retry of the same join still resolves correctly in Leader().
+func (rn *RaftNode) Join(nodeID, raftAddr, httpAddr string) error {
+	if rn.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+	rn.mu.Lock()
+	rn.httpAddrs[raft.ServerAddress(raftAddr)] = httpAddr
+	rn.mu.Unlock()
+
+	future := rn.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(raftAddr), 0, 0)
+	return future.Error()
+}
+
+// Remove removes nodeID from the cluster. Only the current leader can do
+// this.
+func (rn *RaftNode) Remove(nodeID string) error {
+	if rn.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+	future := rn.raft.RemoveServer(raft.ServerID(nodeID), 0, 0)
+	return future.Error()
+}
+
+// Leader reports the HTTP API address of whichever node this node
+// currently believes is leader, so a client-facing "not leader, try %s"
+// error points somewhere the client can actually reach. Falls back to the
+// raw Raft transport address if that node never registered an HTTP
+// address with us (e.g. we haven't seen its /cluster/join yet).
+func (rn *RaftNode) Leader() string {
+	addr, _ := rn.raft.LeaderWithID()
+
+	rn.mu.RLock()
+	defer rn.mu.RUnlock()
+	if httpAddr, ok := rn.httpAddrs[addr]; ok && httpAddr != "" {
+		return httpAddr
+	}
+	return string(addr)
+}
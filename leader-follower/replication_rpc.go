@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// This file is the hand-written counterpart to proto/replication.proto: the
+// repo has no protoc/buf codegen step, so the wire types and
+// grpc.ServiceDesc below are authored directly against grpc-go's streaming
+// API instead of generated. grpc_transport.go builds on these to implement
+// REPL_TRANSPORT=grpc.
+
+// LogEntry is one replicated mutation, pipelined onto a follower's Apply
+// stream without waiting for its Ack - the gRPC analogue of the JSON body
+// replicateToFollower currently POSTs to /replicate.
+type LogEntry struct {
+	Seq     int64  `json:"seq"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version int    `json:"version"`
+	Deleted bool   `json:"deleted"`
+}
+
+// Ack answers a LogEntry by Seq, since acks can arrive out of order relative
+// to later entries already pipelined onto the same stream. AppliedAtUnixNano
+// is what recordSafeTimestamp gossips today over the HTTP response; Error is
+// set instead of failing the stream, so one bad entry doesn't tear down the
+// long-lived connection queued entries behind it still need.
+type Ack struct {
+	Seq               int64  `json:"seq"`
+	AppliedAtUnixNano int64  `json:"applied_at_unix_nano"`
+	Error             string `json:"error,omitempty"`
+}
+
+// SnapshotReq requests a full point-in-time copy of the serving node's
+// store, for bootstrapping a new follower.
+type SnapshotReq struct{}
+
+// KVPairProto is the wire shape of one entry in a Snapshot Chunk.
+type KVPairProto struct {
+	Value             string `json:"value"`
+	Version           int    `json:"version"`
+	Deleted           bool   `json:"deleted"`
+	AppliedAtUnixNano int64  `json:"applied_at_unix_nano"`
+}
+
+// Chunk is one batch of a Snapshot stream; the final chunk has Done=true.
+type Chunk struct {
+	Pairs map[string]KVPairProto `json:"pairs"`
+	Done  bool                   `json:"done"`
+}
+
+// kvJSONCodecName is registered as a grpc/encoding.Codec so Apply/Snapshot
+// can move the structs above over a real grpc.ClientConn/grpc.Server
+// without a protobuf-generated Marshal/Unmarshal.
+const kvJSONCodecName = "kvjson"
+
+type kvJSONCodec struct{}
+
+func (kvJSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (kvJSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (kvJSONCodec) Name() string                               { return kvJSONCodecName }
+
+func init() {
+	encoding.RegisterCodec(kvJSONCodec{})
+}
+
+// replicatorServer is the server-side contract for the replication.proto
+// Replicator service; grpcReplicationServer in grpc_transport.go implements it.
+type replicatorServer interface {
+	Apply(ApplyServerStream) error
+	Snapshot(*SnapshotReq, SnapshotServerStream) error
+}
+
+// ApplyServerStream is the server's view of the bidi Apply stream.
+type ApplyServerStream interface {
+	Send(*Ack) error
+	Recv() (*LogEntry, error)
+}
+
+type applyServerStream struct{ grpc.ServerStream }
+
+func (s *applyServerStream) Send(a *Ack) error { return s.ServerStream.SendMsg(a) }
+
+func (s *applyServerStream) Recv() (*LogEntry, error) {
+	m := new(LogEntry)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SnapshotServerStream is the server's view of the Snapshot server-stream.
+type SnapshotServerStream interface {
+	Send(*Chunk) error
+}
+
+type snapshotServerStream struct{ grpc.ServerStream }
+
+func (s *snapshotServerStream) Send(c *Chunk) error { return s.ServerStream.SendMsg(c) }
+
+func applyStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(replicatorServer).Apply(&applyServerStream{stream})
+}
+
+func snapshotStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(SnapshotReq)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(replicatorServer).Snapshot(req, &snapshotServerStream{stream})
+}
+
+// replicatorServiceDesc mirrors what protoc-gen-go-grpc would emit for the
+// Replicator service in proto/replication.proto.
+var replicatorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "replication.Replicator",
+	HandlerType: (*replicatorServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Apply", Handler: applyStreamHandler, ServerStreams: true, ClientStreams: true},
+		{StreamName: "Snapshot", Handler: snapshotStreamHandler, ServerStreams: true},
+	},
+	Metadata: "replication.proto",
+}
+
+// registerReplicatorServer registers srv against s the way a generated
+// RegisterReplicatorServer func would.
+func registerReplicatorServer(s *grpc.Server, srv replicatorServer) {
+	s.RegisterService(&replicatorServiceDesc, srv)
+}
+
+// ApplyClientStream is the client's view of the bidi Apply stream.
+type ApplyClientStream interface {
+	Send(*LogEntry) error
+	Recv() (*Ack, error)
+	CloseSend() error
+}
+
+type applyClientStream struct{ grpc.ClientStream }
+
+func (s *applyClientStream) Send(e *LogEntry) error { return s.ClientStream.SendMsg(e) }
+
+func (s *applyClientStream) Recv() (*Ack, error) {
+	m := new(Ack)
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type SnapshotClientStream interface {
+	Recv() (*Chunk, error)
+}
+
+type snapshotClientStream struct{ grpc.ClientStream }
+
+func (s *snapshotClientStream) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// grpcReplicatorClient is the hand-rolled counterpart to a generated
+// ReplicatorClient, built directly on cc.NewStream the same way generated
+// code is.
+type grpcReplicatorClient struct {
+	cc *grpc.ClientConn
+}
+
+func newGRPCReplicatorClient(cc *grpc.ClientConn) *grpcReplicatorClient {
+	return &grpcReplicatorClient{cc: cc}
+}
+
+func (c *grpcReplicatorClient) Apply(ctx context.Context) (ApplyClientStream, error) {
+	stream, err := c.cc.NewStream(ctx, &replicatorServiceDesc.Streams[0], "/replication.Replicator/Apply", grpc.CallContentSubtype(kvJSONCodecName))
+	if err != nil {
+		return nil, err
+	}
+	return &applyClientStream{stream}, nil
+}
+
+func (c *grpcReplicatorClient) Snapshot(ctx context.Context, req *SnapshotReq) (SnapshotClientStream, error) {
+	stream, err := c.cc.NewStream(ctx, &replicatorServiceDesc.Streams[1], "/replication.Replicator/Snapshot", grpc.CallContentSubtype(kvJSONCodecName))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &snapshotClientStream{stream}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// S3Config controls timeouts, retries, and clock-skew tolerance for
+// S3Store, so a slow or misbehaving endpoint can't hang a coordinator
+// forever and block quorum writes.
+type S3Config struct {
+	// ConnectTimeout bounds quick metadata calls (Head/Create/Delete/List).
+	ConnectTimeout time.Duration `json:"connect_timeout_seconds"`
+	// ReadTimeout bounds calls that move object data (Get/Put), which can
+	// legitimately take much longer for large values.
+	ReadTimeout time.Duration `json:"read_timeout_seconds"`
+	// MaxRetries is passed to the SDK's standard retryer.
+	MaxRetries int `json:"max_retries"`
+	// MaxClockSkew rejects GetObject responses whose Last-Modified header
+	// is further from local time than this, guarding against corrupted or
+	// replayed responses.
+	MaxClockSkew time.Duration `json:"max_clock_skew_seconds"`
+}
+
+// DefaultS3Config mirrors keepstore's s3aws_volume defaults.
+func DefaultS3Config() S3Config {
+	return S3Config{
+		ConnectTimeout: 60 * time.Second,
+		ReadTimeout:    10 * time.Minute,
+		MaxRetries:     3,
+		MaxClockSkew:   600 * time.Second,
+	}
+}
+
+// loadS3ConfigFromEnv overlays S3_CONNECT_TIMEOUT / S3_READ_TIMEOUT (as
+// Go durations, e.g. "60s") and S3_MAX_RETRIES / S3_MAX_CLOCK_SKEW (as
+// integer seconds/count) on top of the defaults.
+func loadS3ConfigFromEnv() S3Config {
+	cfg := DefaultS3Config()
+
+	if v := os.Getenv("S3_CONNECT_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ConnectTimeout = d
+		}
+	}
+	if v := os.Getenv("S3_READ_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ReadTimeout = d
+		}
+	}
+	if v := os.Getenv("S3_MAX_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxRetries = n
+		}
+	}
+	if v := os.Getenv("S3_MAX_CLOCK_SKEW"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxClockSkew = time.Duration(n) * time.Second
+		}
+	}
+
+	return cfg
+}
+
+// HealthInfo reports the effective config so operators can verify it via
+// /health without having to read node env vars directly.
+func (c S3Config) HealthInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"connect_timeout": c.ConnectTimeout.String(),
+		"read_timeout":    c.ReadTimeout.String(),
+		"max_retries":     c.MaxRetries,
+		"max_clock_skew":  c.MaxClockSkew.String(),
+	}
+}
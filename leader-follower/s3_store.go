@@ -5,24 +5,104 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithy "github.com/aws/smithy-go"
+	smithymiddleware "github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
+// Retry tuning for the optimistic-concurrency loop in SetReader.
+const (
+	s3MaxConflictRetries = 5
+	s3ConflictBackoff    = 50 * time.Millisecond
+)
+
+// Tuning for the multipart uploader, matching the defaults keepstore's
+// s3aws_volume uses for its writer pool.
+const (
+	s3DefaultPartSize    = 5 * 1024 * 1024 // 5 MiB
+	s3DefaultConcurrency = 5
+)
+
+const s3VersionMetadataKey = "Version"
+
+// Metadata keys carrying tombstone state; see Store.Delete for why a
+// delete is a versioned write rather than an object removal.
+const (
+	s3DeletedMetadataKey   = "Deleted"
+	s3DeletedAtMetadataKey = "Deleted-At"
+)
+
+func init() {
+	RegisterDriver("s3", func(cfg json.RawMessage) (Store, error) {
+		var opts struct {
+			Bucket             string `json:"bucket"`
+			ConnectTimeoutSecs int    `json:"connect_timeout_seconds"`
+			ReadTimeoutSecs    int    `json:"read_timeout_seconds"`
+			MaxRetries         int    `json:"max_retries"`
+			MaxClockSkewSecs   int    `json:"max_clock_skew_seconds"`
+		}
+		if len(cfg) > 0 {
+			if err := json.Unmarshal(cfg, &opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Bucket == "" {
+			opts.Bucket = os.Getenv("S3_BUCKET")
+		}
+		if opts.Bucket == "" {
+			return nil, fmt.Errorf("s3 driver requires a bucket name")
+		}
+
+		s3cfg := loadS3ConfigFromEnv()
+		if opts.ConnectTimeoutSecs > 0 {
+			s3cfg.ConnectTimeout = time.Duration(opts.ConnectTimeoutSecs) * time.Second
+		}
+		if opts.ReadTimeoutSecs > 0 {
+			s3cfg.ReadTimeout = time.Duration(opts.ReadTimeoutSecs) * time.Second
+		}
+		if opts.MaxRetries > 0 {
+			s3cfg.MaxRetries = opts.MaxRetries
+		}
+		if opts.MaxClockSkewSecs > 0 {
+			s3cfg.MaxClockSkew = time.Duration(opts.MaxClockSkewSecs) * time.Second
+		}
+
+		return NewS3StoreWithConfig(opts.Bucket, s3cfg)
+	})
+}
+
 // S3Store implements the Store interface using S3 as backend
 type S3Store struct {
 	client *s3.Client
 	bucket string
+	cfg    S3Config
 }
 
+// NewS3Store creates an S3Store with timeouts/retries/clock-skew tolerance
+// taken from the environment. Use NewS3StoreWithConfig to set them directly.
 func NewS3Store(bucket string) (*S3Store, error) {
-	ctx := context.Background()
+	return NewS3StoreWithConfig(bucket, loadS3ConfigFromEnv())
+}
+
+func NewS3StoreWithConfig(bucket string, s3cfg S3Config) (*S3Store, error) {
+	connectCtx, cancel := context.WithTimeout(context.Background(), s3cfg.ConnectTimeout)
+	defer cancel()
 
 	var cfg aws.Config
 	var err error
@@ -40,11 +120,16 @@ func NewS3Store(bucket string) (*S3Store, error) {
 	println("[DEBUG] Using AWS_REGION =", region)
 	println("[DEBUG] Using S3_ENDPOINT =", endpoint)
 
+	retryer := retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = s3cfg.MaxRetries
+	})
+
 	if endpoint != "" {
 		// LocalStack mode
 		cfg, err = config.LoadDefaultConfig(
-			ctx,
+			connectCtx,
 			config.WithRegion(region),
+			config.WithRetryer(func() aws.Retryer { return retryer }),
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
 			config.WithEndpointResolverWithOptions(
 				aws.EndpointResolverWithOptionsFunc(
@@ -63,8 +148,9 @@ func NewS3Store(bucket string) (*S3Store, error) {
 	} else {
 		// Real AWS (critical fix: Must supply region explicitly)
 		cfg, err = config.LoadDefaultConfig(
-			ctx,
+			connectCtx,
 			config.WithRegion(region),
+			config.WithRetryer(func() aws.Retryer { return retryer }),
 		)
 	}
 
@@ -76,10 +162,12 @@ func NewS3Store(bucket string) (*S3Store, error) {
 	store := &S3Store{
 		client: client,
 		bucket: bucket,
+		cfg:    s3cfg,
 	}
 
 	// Try to create bucket
-	_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{
+	createStart := time.Now()
+	_, err = client.CreateBucket(connectCtx, &s3.CreateBucketInput{
 		Bucket: aws.String(bucket),
 		CreateBucketConfiguration: &types.CreateBucketConfiguration{
 			LocationConstraint: types.BucketLocationConstraint(region),
@@ -88,82 +176,435 @@ func NewS3Store(bucket string) (*S3Store, error) {
 	if err != nil {
 		var be *types.BucketAlreadyOwnedByYou
 		if !errors.As(err, &be) {
+			observeS3Op("create_bucket", createStart, err)
 			return nil, err
 		}
 	}
+	observeS3Op("create_bucket", createStart, nil)
 
 	return store, nil
 }
 
-// Write to S3
+// HealthInfo reports the store's effective timeout/retry/clock-skew config.
+func (s *S3Store) HealthInfo() map[string]interface{} {
+	return s.cfg.HealthInfo()
+}
+
+// Set stores value under key, buffering it once into memory. Large values
+// should go through SetReader instead so they never have to fit in RAM on
+// the coordinator or its followers.
 func (s *S3Store) Set(key, value string, version *int) (int, error) {
-	ctx := context.Background()
+	start := time.Now()
+	v, err := s.SetReader(key, strings.NewReader(value), version)
+	observeS3Op("set", start, err)
+	return v, err
+}
+
+// SetReader streams r straight into S3 via the multipart uploader instead of
+// buffering the whole payload, so a multi-GB value doesn't stall replication
+// or blow memory on the node handling it. The version is carried as object
+// metadata rather than wrapped in a JSON envelope, since the body itself may
+// now be arbitrary binary data.
+//
+// When version is nil (a coordinator assigning the next version itself),
+// two coordinators can race to read the same old version and both write
+// v+1. SetReader guards against that by conditioning the PutObject on the
+// ETag it just read (IfMatch) or on the key not existing yet (IfNoneMatch);
+// a 412 from S3 means someone else won the race, so it re-reads the latest
+// version and tries again, making up to s3MaxConflictRetries attempts in
+// all before giving up with ErrConflict.
+func (s *S3Store) SetReader(key string, r io.Reader, version *int) (int, error) {
+	if version != nil {
+		// Follower replication: the leader already assigned the version,
+		// so there's nothing to race against - stream straight through.
+		return s.putObject(key, r, *version, nil, nil, nil)
+	}
+
+	// Coordinator write: buffer once so a conflicting attempt can be
+	// retried without needing to re-read an already-consumed stream.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
 
-	// calculate version: if leader writes (version == nil), based on existing version +1
-	var v int
-	if version == nil {
-		old, exists, err := s.Get(key)
+	backoff := s3ConflictBackoff
+	for attempt := 0; attempt < s3MaxConflictRetries; attempt++ {
+		oldVersion, etag, exists, err := s.headMeta(key)
 		if err != nil {
 			return 0, err
 		}
+
+		var v int
+		var ifMatch, ifNoneMatch *string
 		if exists {
-			v = old.Version + 1
+			v = oldVersion + 1
+			ifMatch = aws.String(etag)
 		} else {
 			v = 1
+			ifNoneMatch = aws.String("*")
+		}
+
+		_, err = s.putObject(key, bytes.NewReader(data), v, ifMatch, ifNoneMatch, nil)
+		if err == nil {
+			return v, nil
+		}
+		if !isPreconditionFailed(err) {
+			return 0, err
 		}
-	} else {
-		// follower replication uses given version
-		v = *version
-	}
 
-	obj := KVPair{
-		Value:   value,
-		Version: v,
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 
-	data, err := json.Marshal(obj)
-	if err != nil {
-		return 0, err
+	return 0, ErrConflict
+}
+
+// putObject uploads data under key carrying version as metadata, optionally
+// conditioned on ifMatch/ifNoneMatch for optimistic concurrency. tombstone,
+// if non-nil, marks the object as deleted/restored rather than live.
+func (s *S3Store) putObject(key string, r io.Reader, version int, ifMatch, ifNoneMatch *string, tombstone *KVPair) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ReadTimeout)
+	defer cancel()
+
+	uploader := manager.NewUploader(s.client, func(u *manager.Uploader) {
+		u.PartSize = s3DefaultPartSize
+		u.Concurrency = s3DefaultConcurrency
+	})
+
+	metadata := map[string]string{
+		s3VersionMetadataKey: strconv.Itoa(version),
+	}
+	if tombstone != nil && tombstone.Deleted {
+		metadata[s3DeletedMetadataKey] = "true"
+		metadata[s3DeletedAtMetadataKey] = tombstone.DeletedAt.Format(time.RFC3339)
 	}
 
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-		Body:   bytes.NewReader(data),
+	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        r,
+		IfMatch:     ifMatch,
+		IfNoneMatch: ifNoneMatch,
+		Metadata:    metadata,
 	})
 	if err != nil {
 		return 0, err
 	}
 
-	return v, nil
+	return version, nil
+}
+
+// isPreconditionFailed reports whether err is S3 rejecting a conditional
+// PutObject because the IfMatch/IfNoneMatch precondition no longer holds.
+func isPreconditionFailed(err error) bool {
+	return s3ErrorCode(err) == "PreconditionFailed"
 }
 
-// Read from S3
+// s3ErrorCode extracts the S3/smithy error code from err, for labeling
+// kv_s3_op_errors_total.
+func s3ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "unknown"
+}
+
+// Get reads value fully into memory. Prefer GetReader for large values.
 func (s *S3Store) Get(key string) (KVPair, bool, error) {
-	ctx := context.Background()
+	start := time.Now()
 
+	rc, pair, exists, err := s.GetReader(key)
+	if err != nil || !exists {
+		observeS3Op("get", start, err)
+		return KVPair{}, exists, err
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		observeS3Op("get", start, err)
+		return KVPair{}, false, err
+	}
+	pair.Value = string(b)
+
+	observeS3Op("get", start, nil)
+	return pair, true, nil
+}
+
+// GetReader streams the object body straight from S3 without buffering it,
+// so followers replicating large blobs don't need to hold them in memory.
+// The caller is responsible for closing the returned reader.
+func (s *S3Store) GetReader(key string) (io.ReadCloser, KVPair, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ReadTimeout)
+
+	var responseDate time.Time
 	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
+	}, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, captureResponseDateAPIOption(&responseDate))
 	})
 	if err != nil {
+		cancel()
 		var nsk *types.NoSuchKey
 		if errors.As(err, &nsk) {
-			return KVPair{}, false, nil
+			return nil, KVPair{}, false, nil
 		}
-		return KVPair{}, false, err
+		return nil, KVPair{}, false, err
+	}
+
+	// responseDate is the HTTP response's Date header - when S3 generated
+	// this response - not out.LastModified, which is when the object's
+	// content was last written and has nothing to do with clock skew: a
+	// key that hasn't been overwritten in an hour would otherwise fail
+	// this check on every read. Reject it if it's further from local time
+	// than MaxClockSkew tolerates, which catches corrupted or replayed
+	// responses.
+	if err := checkClockSkew(responseDate, s.cfg.MaxClockSkew); err != nil {
+		out.Body.Close()
+		cancel()
+		return nil, KVPair{}, false, err
+	}
+
+	version, _ := strconv.Atoi(out.Metadata[s3VersionMetadataKey])
+	deleted := out.Metadata[s3DeletedMetadataKey] == "true"
+	var deletedAt time.Time
+	if ts := out.Metadata[s3DeletedAtMetadataKey]; ts != "" {
+		deletedAt, _ = time.Parse(time.RFC3339, ts)
+	}
+
+	// S3 already tracks per-object last-write time; reuse it as AppliedAt
+	// instead of carrying a redundant metadata field.
+	var appliedAt time.Time
+	if out.LastModified != nil {
+		appliedAt = *out.LastModified
+	}
+
+	return &cancelOnCloseBody{ReadCloser: out.Body, cancel: cancel}, KVPair{Version: version, ETag: aws.ToString(out.ETag), Deleted: deleted, DeletedAt: deletedAt, AppliedAt: appliedAt}, true, nil
+}
+
+// cancelOnCloseBody releases GetReader's request context once the caller
+// closes the body, so the context stays live while the body is read.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// checkClockSkew rejects a response timestamp that is further from local
+// time than maxSkew allows. responseDate is the zero Time if the response
+// carried no (or an unparseable) Date header, in which case there's nothing
+// to check.
+func checkClockSkew(responseDate time.Time, maxSkew time.Duration) error {
+	if responseDate.IsZero() {
+		return nil
+	}
+	skew := time.Since(responseDate)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		return fmt.Errorf("S3 response Date %s is %s from local time, exceeding MaxClockSkew %s", responseDate.Format(time.RFC1123), skew, maxSkew)
+	}
+	return nil
+}
+
+// captureResponseDateAPIOption installs a deserialize-step middleware that
+// copies the HTTP response's Date header into *dst. GetObjectOutput doesn't
+// expose response headers directly, so this is the only way to get at the
+// header checkClockSkew actually needs to distinguish "response generated
+// just now" from out.LastModified's unrelated "object content last written
+// at this time".
+func captureResponseDateAPIOption(dst *time.Time) func(*smithymiddleware.Stack) error {
+	return func(stack *smithymiddleware.Stack) error {
+		return stack.Deserialize.Add(&captureResponseDateMiddleware{dst: dst}, smithymiddleware.After)
 	}
-	defer out.Body.Close()
+}
+
+type captureResponseDateMiddleware struct {
+	dst *time.Time
+}
+
+func (*captureResponseDateMiddleware) ID() string { return "captureResponseDate" }
+
+func (m *captureResponseDateMiddleware) HandleDeserialize(
+	ctx context.Context, in smithymiddleware.DeserializeInput, next smithymiddleware.DeserializeHandler,
+) (smithymiddleware.DeserializeOutput, smithymiddleware.Metadata, error) {
+	out, metadata, err := next.HandleDeserialize(ctx, in)
+	if resp, ok := out.RawResponse.(*smithyhttp.Response); ok {
+		if hdr := resp.Header.Get("Date"); hdr != "" {
+			if t, perr := http.ParseTime(hdr); perr == nil {
+				*m.dst = t
+			}
+		}
+	}
+	return out, metadata, err
+}
+
+// headMeta looks up the version and ETag of an existing object without
+// fetching its body, so Set doesn't have to download (and discard) the old
+// value just to compute the next version number or CAS precondition.
+func (s *S3Store) headMeta(key string) (version int, etag string, exists bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ConnectTimeout)
+	defer cancel()
 
-	b, err := io.ReadAll(out.Body)
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return KVPair{}, false, err
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			return 0, "", false, nil
+		}
+		return 0, "", false, err
 	}
 
-	var obj KVPair
-	if err := json.Unmarshal(b, &obj); err != nil {
-		return KVPair{}, false, err
+	version, _ = strconv.Atoi(out.Metadata[s3VersionMetadataKey])
+	return version, aws.ToString(out.ETag), true, nil
+}
+
+// Delete writes a tombstone over the existing object rather than removing
+// it; see the Store.Delete doc comment for why. The object body is kept
+// as-is so Untrash can restore it.
+func (s *S3Store) Delete(key string) error {
+	rc, pair, exists, err := s.GetReader(key)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = bytes.NewReader(nil)
+	if exists {
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	tombstone := KVPair{Deleted: true, DeletedAt: time.Now()}
+	_, err = s.putObject(key, body, pair.Version+1, nil, nil, &tombstone)
+	return err
+}
+
+// Untrash clears a tombstone, restoring the value it shadowed, as long as
+// it is still within TrashLifetime.
+func (s *S3Store) Untrash(key string) error {
+	rc, pair, exists, err := s.GetReader(key)
+	if err != nil {
+		return err
 	}
+	if !exists || !pair.Deleted {
+		if exists {
+			rc.Close()
+		}
+		return fmt.Errorf("key %q has no tombstone to restore", key)
+	}
+	defer rc.Close()
+
+	if time.Since(pair.DeletedAt) > TrashLifetime {
+		return fmt.Errorf("key %q tombstone is past its trash lifetime", key)
+	}
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.putObject(key, bytes.NewReader(data), pair.Version+1, nil, nil, &KVPair{Deleted: false})
+	return err
+}
+
+// HardDelete physically removes an object, tombstoned or not. It's used by
+// the trash sweeper once a tombstone has aged past TrashLifetime.
+func (s *S3Store) HardDelete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ConnectTimeout)
+	defer cancel()
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// List returns every key stored in the bucket
+func (s *S3Store) List() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ConnectTimeout)
+	defer cancel()
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+// HealthCheck verifies the bucket is reachable
+func (s *S3Store) HealthCheck() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ConnectTimeout)
+	defer cancel()
+
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	return err
+}
+
+// s3WatchPollInterval is how often Watch re-reads key, since S3 has no
+// native change feed for us to subscribe to.
+const s3WatchPollInterval = 2 * time.Second
+
+// Watch approximates the Store.Watch contract by polling key on an
+// interval and emitting an event whenever its version changes. It trades
+// delivery latency (up to s3WatchPollInterval) for not needing S3 event
+// notifications wired up out of band.
+func (s *S3Store) Watch(key string) (<-chan Event, func(), error) {
+	ch := make(chan Event, 8)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(ch)
+
+		lastVersion := -1
+		ticker := time.NewTicker(s3WatchPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				pair, exists, err := s.Get(key)
+				if err != nil || !exists || pair.Version == lastVersion {
+					continue
+				}
+				lastVersion = pair.Version
+				select {
+				case ch <- Event{Key: key, Value: pair.Value, Version: pair.Version, Deleted: pair.Deleted}:
+				default:
+				}
+			}
+		}
+	}()
 
-	return obj, true, nil
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(done) }) }
+	return ch, stop, nil
 }
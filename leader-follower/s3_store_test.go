@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestCheckClockSkewUsesResponseDateNotLastModified is the regression test
+// for checkClockSkew comparing the wrong timestamp: an object's
+// Last-Modified is when its content was last written, which for a
+// long-lived key can be arbitrarily far in the past and has nothing to do
+// with whether the response itself is fresh. checkClockSkew must be called
+// with the HTTP response's Date header, so an old Last-Modified must not
+// make it fail.
+func TestCheckClockSkewUsesResponseDateNotLastModified(t *testing.T) {
+	oldLastModified := time.Now().Add(-30 * 24 * time.Hour)
+
+	// A response generated just now, for content written a month ago, must
+	// pass: checkClockSkew is handed the response Date, not LastModified.
+	if err := checkClockSkew(time.Now(), 600*time.Second); err != nil {
+		t.Fatalf("fresh response Date unexpectedly failed clock-skew check: %v", err)
+	}
+
+	// Confirm the old Last-Modified by itself would have failed, so the
+	// test above is actually exercising the fix rather than passing
+	// trivially.
+	if err := checkClockSkew(oldLastModified, 600*time.Second); err == nil {
+		t.Fatalf("expected an old timestamp to fail the clock-skew check")
+	}
+
+	// A zero Time (no Date header on the response) must not be treated as
+	// skewed.
+	if err := checkClockSkew(time.Time{}, 600*time.Second); err != nil {
+		t.Fatalf("zero response Date unexpectedly failed clock-skew check: %v", err)
+	}
+}
+
+// TestGetReaderIgnoresStaleLastModified exercises the fix end-to-end
+// against a fake S3 endpoint: a GetObject response whose Last-Modified is
+// far in the past (the overwhelmingly common case for a KV store - most
+// keys aren't rewritten every few minutes) but whose Date header is fresh
+// must not be rejected as clock skew.
+func TestGetReaderIgnoresStaleLastModified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			// CreateBucket during store setup.
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			w.Header().Set("Last-Modified", time.Now().Add(-30*24*time.Hour).Format(http.TimeFormat))
+			w.Header().Set("x-amz-meta-version", "1")
+			w.Header().Set("Date", time.Now().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("hello"))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("S3_ENDPOINT", srv.URL)
+	os.Setenv("AWS_REGION", "us-west-2")
+	defer os.Unsetenv("S3_ENDPOINT")
+	defer os.Unsetenv("AWS_REGION")
+
+	store, err := NewS3StoreWithConfig("test-bucket", DefaultS3Config())
+	if err != nil {
+		t.Fatalf("NewS3StoreWithConfig failed: %v", err)
+	}
+
+	pair, exists, err := store.Get("some-long-lived-key")
+	if err != nil {
+		t.Fatalf("Get unexpectedly failed with a stale Last-Modified: %v", err)
+	}
+	if !exists {
+		t.Fatalf("expected key to exist")
+	}
+	if pair.Value != "hello" {
+		t.Errorf("expected value %q, got %q", "hello", pair.Value)
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Server represents the HTTP server
@@ -12,15 +16,18 @@ type Server struct {
 	port     string
 	leader   *LeaderNode
 	follower *FollowerNode
+	raft     *RaftNode
 	nodeType string
 }
 
 // NewServer creates a new server
-func NewServer(port string, leader *LeaderNode, follower *FollowerNode, nodeType string) *Server {
+func NewServer(port string, leader *LeaderNode, follower *FollowerNode, raftNode *RaftNode, nodeType string) *Server {
+	registerMetrics()
 	return &Server{
 		port:     port,
 		leader:   leader,
 		follower: follower,
+		raft:     raftNode,
 		nodeType: nodeType,
 	}
 }
@@ -28,22 +35,39 @@ func NewServer(port string, leader *LeaderNode, follower *FollowerNode, nodeType
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	r := mux.NewRouter()
+	// metricsMiddleware wraps every route below, so a new route just
+	// needs a Name() to get request-duration metrics for free.
+	r.Use(metricsMiddleware)
 
 	// Register routes
-	r.HandleFunc("/set", s.handleSet).Methods("POST")
-	r.HandleFunc("/get/{key}", s.handleGet).Methods("GET")
-	r.HandleFunc("/replicate", s.handleReplicate).Methods("POST")
-	r.HandleFunc("/local_read/{key}", s.handleLocalRead).Methods("GET")
-	r.HandleFunc("/health", s.handleHealth).Methods("GET")
+	r.HandleFunc("/set", s.handleSet).Methods("POST").Name("set")
+	r.HandleFunc("/get/{key}", s.handleGet).Methods("GET").Name("get")
+	r.HandleFunc("/replicate", s.handleReplicate).Methods("POST").Name("replicate")
+	r.HandleFunc("/local_read/{key}", s.handleLocalRead).Methods("GET").Name("local_read")
+	r.HandleFunc("/health", s.handleHealth).Methods("GET").Name("health")
+	r.HandleFunc("/admin/untrash/{key}", s.handleUntrash).Methods("POST").Name("untrash")
+	r.HandleFunc("/txn", s.handleTxn).Methods("POST").Name("txn")
+	r.HandleFunc("/cluster/join", s.handleClusterJoin).Methods("POST").Name("cluster_join")
+	r.HandleFunc("/cluster/remove", s.handleClusterRemove).Methods("POST").Name("cluster_remove")
+	r.HandleFunc("/hints/status", s.handleHintsStatus).Methods("GET").Name("hints_status")
+	r.HandleFunc("/resolve", s.handleResolve).Methods("POST").Name("resolve")
+	r.HandleFunc("/admin/bootstrap", s.handleBootstrap).Methods("POST").Name("bootstrap")
+	r.Handle("/metrics", promhttp.Handler()).Name("metrics")
 
 	return http.ListenAndServe(":"+s.port, r)
 }
 
-// handleSet handles set requests : Leader - Follower write logic
+// handleSet handles set requests : Leader - Follower write logic.
+// Store.Set wraps SetReader, so large values still flow through the
+// streaming S3 upload path instead of being buffered a second time here.
+// Context is an opaque token from a prior /get response; clients that read
+// siblings should pass it back so the leader can tell this write apart
+// from one that raced it without seeing the same siblings.
 func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Context string `json:"context"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -51,9 +75,33 @@ func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if s.nodeType == "leader" {
+	switch s.nodeType {
+	case "raft":
+		version, err := s.raft.Set(req.Key, req.Value)
+		if err != nil {
+			if errors.Is(err, ErrNotLeader) {
+				http.Error(w, fmt.Sprintf("not leader, try %s", s.raft.Leader()), http.StatusMisdirectedRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"version": version,
+		})
+
+	case "leader":
+		context, err := decodeContext(req.Context)
+		if err != nil {
+			http.Error(w, "Invalid context token", http.StatusBadRequest)
+			return
+		}
+
 		// Write to leader and replicate to followers
-		statusCode, version, err := s.leader.Write(req.Key, req.Value)
+		statusCode, pair, siblings, err := s.leader.Write(req.Key, req.Value, context)
 		if err != nil {
 			http.Error(w, err.Error(), statusCode)
 			return
@@ -62,13 +110,55 @@ func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(statusCode)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"version": version,
+			"version":  pair.Version,
+			"context":  encodeContext(pair.Clock),
+			"siblings": siblings,
 		})
-	} else {
+
+	default:
 		http.Error(w, "Write requests must go to leader", http.StatusForbidden)
 	}
 }
 
+// handleResolve lets a client collapse a key's sibling set (leader only) by
+// writing back the value it chose together with the context covering every
+// sibling it read, Dynamo-style.
+func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
+	if s.nodeType != "leader" {
+		http.Error(w, "Resolve requests must go to leader", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Context string `json:"context"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	chosen, err := decodeContext(req.Context)
+	if err != nil {
+		http.Error(w, "Invalid context token", http.StatusBadRequest)
+		return
+	}
+
+	statusCode, pair, err := s.leader.Resolve(req.Key, req.Value, chosen)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": pair.Version,
+		"context": encodeContext(pair.Clock),
+	})
+}
+
 // handleGet handles get requests : Leader - Follower read logic
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -78,13 +168,45 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	var value string
 	var version int
 	var err error
+	var clock VectorClock
+	var siblings []Sibling
 
-	// Leader serves read requests directly
-	if s.nodeType == "leader" {
-		statusCode, value, version, err = s.leader.Read(key)
-	} else {
-		// Follower serves read requests locally
-		statusCode, value, version, err = s.follower.LocalRead(key)
+	switch s.nodeType {
+	case "raft":
+		var deleted bool
+		if parseRaftConsistency(r) == "stale" {
+			statusCode, value, version, deleted, err = s.raft.StaleRead(key)
+		} else {
+			statusCode, value, version, deleted, err = s.raft.LinearizableRead(key)
+			if errors.Is(err, ErrNotLeader) {
+				http.Error(w, fmt.Sprintf("not leader, try %s", s.raft.Leader()), http.StatusMisdirectedRequest)
+				return
+			}
+		}
+		if err == nil && deleted {
+			statusCode, err = 404, fmt.Errorf("key not found")
+		}
+
+	case "leader":
+		// Leader serves read requests directly
+		consistency, staleness, parseErr := parseReadConsistency(r)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		statusCode, value, version, err = s.leader.Read(key, consistency, staleness)
+		if err == nil {
+			clock, siblings, _ = s.leader.CausalGet(key)
+		}
+
+	default:
+		// Follower serves read requests locally, masking tombstones as 404
+		// the same way LeaderNode.Read does for client-facing reads.
+		var deleted bool
+		statusCode, value, version, deleted, _, err = s.follower.LocalRead(key)
+		if err == nil && deleted {
+			statusCode, err = 404, fmt.Errorf("key not found")
+		}
 	}
 
 	if err != nil {
@@ -92,12 +214,55 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	resp := map[string]interface{}{
 		"value":   value,
 		"version": version,
-	})
+	}
+	if len(siblings) > 0 {
+		resp["siblings"] = append(siblings, Sibling{Value: value, Clock: clock})
+		resp["context"] = encodeContext(clock)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseReadConsistency reads /get's consistency knobs off the query string.
+// ?staleness=<duration> requests a bounded-staleness read with that bound;
+// ?consistency=eventual requests an unbounded single-replica read; no params
+// at all, or ?consistency=strong, keeps the existing strong quorum read.
+// ?consistency=bounded without a staleness, or any other consistency value,
+// is an error.
+func parseReadConsistency(r *http.Request) (ReadConsistency, time.Duration, error) {
+	if s := r.URL.Query().Get("staleness"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid staleness: %w", err)
+		}
+		return ConsistencyBounded, d, nil
+	}
+
+	switch r.URL.Query().Get("consistency") {
+	case "", "strong":
+		return ConsistencyStrong, 0, nil
+	case "eventual":
+		return ConsistencyEventual, 0, nil
+	case "bounded":
+		return "", 0, fmt.Errorf("consistency=bounded requires a staleness duration")
+	default:
+		return "", 0, fmt.Errorf("unknown consistency level %q", r.URL.Query().Get("consistency"))
+	}
+}
+
+// parseRaftConsistency reads a raft-mode /get's ?consistency= query param:
+// "linearizable" (the default) confirms this node is still leader before
+// reading; "stale" reads the local store without that confirmation.
+func parseRaftConsistency(r *http.Request) string {
+	if c := r.URL.Query().Get("consistency"); c != "" {
+		return c
+	}
+	return "linearizable"
 }
 
 // handleReplicate handles replication requests (follower only)
@@ -111,6 +276,7 @@ func (s *Server) handleReplicate(w http.ResponseWriter, r *http.Request) {
 		Key     string `json:"key"`
 		Value   string `json:"value"`
 		Version int    `json:"version"`
+		Deleted bool   `json:"deleted"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -119,12 +285,13 @@ func (s *Server) handleReplicate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Follower handles replication requests
-	statusCode := s.follower.Replicate(req.Key, req.Value, req.Version)
+	statusCode, appliedAt := s.follower.Replicate(req.Key, req.Value, req.Version, req.Deleted)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "replicated",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "replicated",
+		"applied_at": appliedAt,
 	})
 }
 
@@ -136,12 +303,24 @@ func (s *Server) handleLocalRead(w http.ResponseWriter, r *http.Request) {
 	var statusCode int
 	var value string
 	var version int
+	var deleted bool
+	var appliedAt time.Time
 	var err error
 
-	if s.nodeType == "leader" {
-		statusCode, value, version, err = s.leader.LocalRead(key)
-	} else {
-		statusCode, value, version, err = s.follower.LocalRead(key)
+	switch s.nodeType {
+	case "raft":
+		pair, exists, rerr := s.raft.store.Get(key)
+		if rerr != nil {
+			statusCode, err = 500, rerr
+		} else if !exists {
+			statusCode, err = 404, fmt.Errorf("key not found")
+		} else {
+			statusCode, value, version, deleted, appliedAt = 200, pair.Value, pair.Version, pair.Deleted, pair.AppliedAt
+		}
+	case "leader":
+		statusCode, value, version, deleted, appliedAt, err = s.leader.LocalRead(key)
+	default:
+		statusCode, value, version, deleted, appliedAt, err = s.follower.LocalRead(key)
 	}
 
 	if err != nil {
@@ -152,16 +331,206 @@ func (s *Server) handleLocalRead(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"value":   value,
-		"version": version,
+		"value":      value,
+		"version":    version,
+		"deleted":    deleted,
+		"applied_at": appliedAt,
 	})
 }
 
+// handleUntrash clears a tombstone on the node it's called on, restoring
+// the value it shadowed. It's an admin operation, not part of the
+// replicated write path, so the caller is responsible for invoking it on
+// every node that needs the key restored.
+func (s *Server) handleUntrash(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	var store Store
+	switch {
+	case s.nodeType == "raft" && s.raft != nil:
+		store = s.raft.store
+	case s.nodeType == "leader" && s.leader != nil:
+		store = s.leader.store
+	case s.follower != nil:
+		store = s.follower.store
+	default:
+		http.Error(w, "Untrash requires a leader, follower, or raft store", http.StatusInternalServerError)
+		return
+	}
+
+	if err := store.Untrash(key); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "untrashed"})
+}
+
+// handleBootstrap pulls a full Snapshot from leader_grpc_addr over gRPC
+// and applies it into this node's store (follower only), for bringing up
+// a brand-new follower without replaying its entire write history.
+// REPL_TRANSPORT must be grpc: the HTTP replication path has no
+// equivalent, since it was never built to move a whole keyspace at once.
+func (s *Server) handleBootstrap(w http.ResponseWriter, r *http.Request) {
+	if s.follower == nil {
+		http.Error(w, "Bootstrap requests must go to a follower", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		LeaderGRPCAddr string `json:"leader_grpc_addr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LeaderGRPCAddr == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	tlsConfig, err := buildReplTLSConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.follower.BootstrapFromSnapshot(req.LeaderGRPCAddr, tlsConfig); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "bootstrapped"})
+}
+
+// handleHintsStatus reports the hinted-handoff queue depth per follower
+// (leader only), so tests and operators can wait for a hint backlog to
+// drain instead of sleeping a fixed duration.
+func (s *Server) handleHintsStatus(w http.ResponseWriter, r *http.Request) {
+	if s.nodeType != "leader" {
+		http.Error(w, "Hints are only tracked on the leader", http.StatusForbidden)
+		return
+	}
+
+	hints := s.leader.Hints()
+	pending := make(map[string]int, len(hints))
+	for peer, queued := range hints {
+		pending[peer] = len(queued)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pending": pending,
+		"hints":   hints,
+	})
+}
+
+// handleTxn handles compare-and-swap transaction requests (leader only).
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if s.nodeType != "leader" {
+		http.Error(w, "Txn requests must go to leader", http.StatusForbidden)
+		return
+	}
+
+	var req TxnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.leader.Txn(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleClusterJoin adds a new voter node to the Raft cluster (raft mode
+// only). Only the current leader can process this; a non-leader returns a
+// redirect hint pointing at the node it believes is leader.
+func (s *Server) handleClusterJoin(w http.ResponseWriter, r *http.Request) {
+	if s.nodeType != "raft" {
+		http.Error(w, "Not a raft node", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		NodeID   string `json:"node_id"`
+		RaftAddr string `json:"raft_addr"`
+		HTTPAddr string `json:"http_addr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.raft.Join(req.NodeID, req.RaftAddr, req.HTTPAddr); err != nil {
+		if errors.Is(err, ErrNotLeader) {
+			http.Error(w, fmt.Sprintf("not leader, try %s", s.raft.Leader()), http.StatusMisdirectedRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "joined"})
+}
+
+// handleClusterRemove removes a voter node from the Raft cluster (raft mode
+// only), e.g. after it's been permanently decommissioned.
+func (s *Server) handleClusterRemove(w http.ResponseWriter, r *http.Request) {
+	if s.nodeType != "raft" {
+		http.Error(w, "Not a raft node", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.raft.Remove(req.NodeID); err != nil {
+		if errors.Is(err, ErrNotLeader) {
+			http.Error(w, fmt.Sprintf("not leader, try %s", s.raft.Leader()), http.StatusMisdirectedRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "removed"})
+}
+
+// configReporter is implemented by stores that want their effective config
+// (timeouts, retries, ...) surfaced on /health for operators.
+type configReporter interface {
+	HealthInfo() map[string]interface{}
+}
+
 // handleHealth handles health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	resp := map[string]interface{}{
 		"status":    "healthy",
 		"node_type": s.nodeType,
-	})
+	}
+
+	var store Store
+	if s.nodeType == "leader" && s.leader != nil {
+		store = s.leader.store
+	} else if s.follower != nil {
+		store = s.follower.store
+	}
+	if reporter, ok := store.(configReporter); ok {
+		resp["store_config"] = reporter.HealthInfo()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
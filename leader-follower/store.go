@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrConflict is returned by Set/SetReader when an optimistic-concurrency
+// backend (S3Store) loses a compare-and-swap race and exhausts its retries.
+// Callers should surface this to clients as a 409 Conflict.
+var ErrConflict = errors.New("version conflict: object was modified concurrently")
+
+// Store is the interface every storage backend (in-memory, on-disk, S3, ...)
+// must satisfy so leader/follower nodes can be wired up without caring where
+// the bytes actually live.
+type Store interface {
+	Get(key string) (KVPair, bool, error)
+	Set(key, value string, version *int) (int, error)
+	// GetReader and SetReader stream the value instead of buffering it,
+	// so large blobs don't have to fit in memory on the node handling
+	// them. Get/Set are convenience wrappers around these for callers
+	// that already have the value as a string.
+	GetReader(key string) (io.ReadCloser, KVPair, bool, error)
+	SetReader(key string, r io.Reader, version *int) (int, error)
+	// Delete writes a tombstone rather than removing the record, so a
+	// delete that reaches some replicas before others during the
+	// replication window looks like any other versioned write instead of
+	// a live-vs-missing inconsistency. Get still returns the tombstone
+	// itself (callers that need replication/quorum semantics depend on
+	// seeing its version); client-facing reads mask it as 404 at the
+	// LeaderNode.Read / handler layer instead. The tombstone is physically
+	// removed later by the trash sweeper once TrashLifetime has passed.
+	Delete(key string) error
+	// Untrash clears a tombstone, restoring the value it shadowed, as
+	// long as it is still within TrashLifetime.
+	Untrash(key string) error
+	List() ([]string, error)
+	HealthCheck() error
+	// Watch subscribes to changes on key, so a leader can drive
+	// replication from the backend's own change notifications instead of
+	// the fan-out POSTs LeaderNode.Write does today. It returns a channel
+	// of future events and a stop func the caller must invoke once done
+	// watching, to unsubscribe and release the channel. Backends with no
+	// native change feed (memory, local) approximate this with an
+	// in-process pub/sub; S3 falls back to polling.
+	Watch(key string) (<-chan Event, func(), error)
+}
+
+// Event is a single change notification delivered by Store.Watch.
+type Event struct {
+	Key     string
+	Value   string
+	Version int
+	Deleted bool
+}
+
+// HardDeleter is implemented by stores whose Delete only tombstones, to
+// expose the actual physical removal the trash sweeper needs.
+type HardDeleter interface {
+	HardDelete(key string) error
+}
+
+// VersionVectorStore is implemented by stores that track a causal vector
+// clock per key instead of trusting Set's scalar version to order writes.
+// It's what lets LeaderNode detect two writes that raced without either
+// having seen the other, and keep both as siblings rather than one
+// silently overwriting the other. KVStore is the only backend that
+// implements it today; LeaderNode falls back to plain Set/Get on stores
+// that don't.
+type VersionVectorStore interface {
+	// SetVC stores value under key, merging context (the clock the client
+	// last saw, possibly nil) with whatever this store already has
+	// recorded for key. nodeID's component is incremented in the result.
+	// A non-nil siblings return means context didn't dominate the
+	// previously stored value, so that value is kept alongside the new
+	// one instead of being discarded.
+	SetVC(key, value string, context VectorClock, nodeID string) (KVPair, []Sibling, error)
+	// Resolve collapses key's current siblings by writing back value with
+	// a clock that merges chosen with whatever is already stored, the
+	// same way SetVC does, but without treating the result as a new
+	// conflict - it's the client's explicit answer to a sibling set it
+	// already saw.
+	Resolve(key, value string, chosen VectorClock, nodeID string) (KVPair, error)
+	// CausalGet returns key's current merged clock and any unresolved
+	// siblings. ok is false if key has no causal state recorded yet (e.g.
+	// it was only ever written through plain Set).
+	CausalGet(key string) (clock VectorClock, siblings []Sibling, ok bool)
+}
+
+// DriverFactory builds a Store from its raw per-node JSON config.
+type DriverFactory func(cfg json.RawMessage) (Store, error)
+
+var drivers = map[string]DriverFactory{}
+
+// RegisterDriver makes a storage backend available under name. Drivers
+// register themselves from an init() in their own file, mirroring the
+// database/sql driver registration pattern.
+func RegisterDriver(name string, factory DriverFactory) {
+	drivers[name] = factory
+}
+
+// NewStore instantiates the named driver with the given config.
+func NewStore(name string, cfg json.RawMessage) (Store, error) {
+	factory, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown store driver %q", name)
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestMemoryDriverCRUD exercises the registry-driven "memory" backend the
+// way leaderless's TestLeaderlessInconsistencyWindow exercises a live
+// cluster, but without needing S3 to run the same Get/Set/Delete/List path.
+func TestMemoryDriverCRUD(t *testing.T) {
+	store, err := NewStore("memory", nil)
+	if err != nil {
+		t.Fatalf("NewStore(memory) failed: %v", err)
+	}
+
+	if _, err := store.Set("foo", "bar", nil); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	pair, exists, err := store.Get("foo")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !exists || pair.Value != "bar" {
+		t.Fatalf("expected foo=bar, got exists=%v pair=%+v", exists, pair)
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("expected [foo], got %v", keys)
+	}
+
+	if err := store.HealthCheck(); err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+
+	if err := store.Delete("foo"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if pair, exists, _ := store.Get("foo"); !exists || !pair.Deleted {
+		t.Fatalf("expected foo to still be readable as a tombstone, got exists=%v pair=%+v", exists, pair)
+	}
+}
+
+// TestMemoryDriverTombstoneUntrash checks that Delete leaves a tombstone
+// Get can still see (for replication/quorum), and that Untrash clears it.
+func TestMemoryDriverTombstoneUntrash(t *testing.T) {
+	store, err := NewStore("memory", nil)
+	if err != nil {
+		t.Fatalf("NewStore(memory) failed: %v", err)
+	}
+
+	if _, err := store.Set("foo", "bar", nil); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.Delete("foo"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	pair, exists, err := store.Get("foo")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !exists || !pair.Deleted || pair.Version != 2 {
+		t.Fatalf("expected a v2 tombstone, got exists=%v pair=%+v", exists, pair)
+	}
+
+	if err := store.Untrash("foo"); err != nil {
+		t.Fatalf("Untrash failed: %v", err)
+	}
+
+	pair, exists, err = store.Get("foo")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !exists || pair.Deleted || pair.Value != "bar" || pair.Version != 3 {
+		t.Fatalf("expected restored v3 value, got exists=%v pair=%+v", exists, pair)
+	}
+
+	if err := store.Untrash("missing"); err == nil {
+		t.Fatalf("expected Untrash on a non-tombstoned key to fail")
+	}
+}
+
+func TestNewStoreUnknownDriver(t *testing.T) {
+	if _, err := NewStore("nope", nil); err == nil {
+		t.Fatalf("expected error for unknown driver")
+	}
+}
+
+// TestMemoryDriverWatch checks that a Watch subscriber sees a Set and a
+// Delete on the key it's watching, and nothing once it's stopped.
+func TestMemoryDriverWatch(t *testing.T) {
+	store, err := NewStore("memory", nil)
+	if err != nil {
+		t.Fatalf("NewStore(memory) failed: %v", err)
+	}
+
+	ch, stop, err := store.Watch("foo")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	if _, err := store.Set("foo", "bar", nil); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if ev := <-ch; ev.Value != "bar" || ev.Version != 1 || ev.Deleted {
+		t.Fatalf("expected set event for v1=bar, got %+v", ev)
+	}
+
+	if err := store.Delete("foo"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ev := <-ch; !ev.Deleted || ev.Version != 2 {
+		t.Fatalf("expected delete event for v2, got %+v", ev)
+	}
+
+	stop()
+	if _, ok := <-ch; ok {
+		t.Fatalf("expected channel to be closed after stop")
+	}
+}
+
+// TestMemoryDriverStreaming exercises the SetReader/GetReader pair that
+// large-value callers (and S3Store) use instead of Set/Get.
+func TestMemoryDriverStreaming(t *testing.T) {
+	store, err := NewStore("memory", nil)
+	if err != nil {
+		t.Fatalf("NewStore(memory) failed: %v", err)
+	}
+
+	if _, err := store.SetReader("big", strings.NewReader("streamed-value"), nil); err != nil {
+		t.Fatalf("SetReader failed: %v", err)
+	}
+
+	rc, pair, exists, err := store.GetReader("big")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	if !exists {
+		t.Fatalf("expected big to exist")
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading stream failed: %v", err)
+	}
+	if string(data) != "streamed-value" || pair.Version != 1 {
+		t.Fatalf("expected streamed-value/v1, got %q/v%d", data, pair.Version)
+	}
+}
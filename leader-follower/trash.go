@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// TrashLifetime is how long a tombstone is kept around before the sweeper
+// hard-deletes it, matching the 336h (14 day) default Arvados uses for
+// BlobTrashLifetime. Override with BLOB_TRASH_LIFETIME (a Go duration
+// string, e.g. "72h").
+var TrashLifetime = loadTrashLifetime()
+
+func loadTrashLifetime() time.Duration {
+	if v := os.Getenv("BLOB_TRASH_LIFETIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return 336 * time.Hour
+}
+
+// RunTrashSweeper periodically hard-deletes tombstones older than
+// TrashLifetime. It never returns; callers start it with `go`.
+func RunTrashSweeper(store Store, interval time.Duration) {
+	deleter, ok := store.(HardDeleter)
+	if !ok {
+		return // backend has nothing to sweep
+	}
+
+	for {
+		time.Sleep(interval)
+
+		keys, err := store.List()
+		if err != nil {
+			logger.Error("trash sweeper: List failed", "error", err)
+			continue
+		}
+
+		for _, key := range keys {
+			pair, exists, err := store.Get(key)
+			if err != nil || !exists || !pair.Deleted {
+				continue
+			}
+			if time.Since(pair.DeletedAt) < TrashLifetime {
+				continue
+			}
+			if err := deleter.HardDelete(key); err != nil {
+				logger.Error("trash sweeper: HardDelete failed", "key", key, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import "sync"
+
+// watchHubEventBuffer is how many unread events a single Watch subscriber
+// is allowed to queue before watchHub starts dropping its events rather
+// than blocking the Set/Delete that's publishing them.
+const watchHubEventBuffer = 8
+
+// watchHub is an in-process pub/sub helper embedded by backends that have
+// no change feed of their own (KVStore, LocalStore): every Set/Delete calls
+// notify, and Watch hands back a channel fed by it. Backends with a real
+// change feed (EtcdStore, ConsulStore) implement Watch directly against
+// that API instead of embedding this.
+type watchHub struct {
+	mu   sync.Mutex
+	subs map[string][]chan Event
+}
+
+// watch subscribes to key, returning the event channel and a stop func that
+// unsubscribes and closes it. Callers must call stop once they're done
+// watching or the subscription leaks.
+func (h *watchHub) watch(key string) (<-chan Event, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[string][]chan Event)
+	}
+	ch := make(chan Event, watchHubEventBuffer)
+	h.subs[key] = append(h.subs[key], ch)
+
+	stopped := false
+	stop := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if stopped {
+			return
+		}
+		stopped = true
+		subs := h.subs[key]
+		for i, c := range subs {
+			if c == ch {
+				h.subs[key] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}
+	return ch, stop, nil
+}
+
+// notify publishes ev to every current subscriber of ev.Key. A subscriber
+// that isn't keeping up has its event dropped rather than blocking the
+// Set/Delete that triggered it.
+func (h *watchHub) notify(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ch := range h.subs[ev.Key] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
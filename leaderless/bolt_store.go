@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltKVBucket   = "kv"
+	boltMetaBucket = "meta"
+	boltVersionKey = "version_counter"
+)
+
+// BoltStore is a KVStore backed by an embedded BoltDB file: every key's
+// sibling set is persisted as a JSON record, and versionCounter is
+// checkpointed in the same file, so a node recovers its full dataset after
+// a crash instead of starting from empty the way MemoryStore does.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a BoltDB file at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(boltKVBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(boltMetaBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func getEntry(tx *bolt.Tx, key string) (kvEntry, error) {
+	data := tx.Bucket([]byte(boltKVBucket)).Get([]byte(key))
+	if data == nil {
+		return kvEntry{}, nil
+	}
+	var entry kvEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return kvEntry{}, err
+	}
+	return entry, nil
+}
+
+func putEntry(tx *bolt.Tx, key string, entry kvEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(boltKVBucket)).Put([]byte(key), data)
+}
+
+func readVersionCounter(tx *bolt.Tx) int {
+	data := tx.Bucket([]byte(boltMetaBucket)).Get([]byte(boltVersionKey))
+	if data == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(data))
+}
+
+func writeVersionCounter(tx *bolt.Tx, v int) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(v))
+	return tx.Bucket([]byte(boltMetaBucket)).Put([]byte(boltVersionKey), data)
+}
+
+// Set performs a coordinator-side write with the same merge semantics as
+// MemoryStore.Set, durably checkpointing versionCounter in the same
+// transaction as the write itself.
+func (b *BoltStore) Set(key, value, nodeID string, context VectorClock) KVPair {
+	pair, err := b.put(key, value, false, nodeID, context)
+	if err != nil {
+		log.Printf("bolt store: set %q failed: %v", key, err)
+	}
+	return pair
+}
+
+// Delete writes a tombstone for key, with the same context/clock-merge
+// semantics as Set.
+func (b *BoltStore) Delete(key, nodeID string, context VectorClock) KVPair {
+	pair, err := b.put(key, "", true, nodeID, context)
+	if err != nil {
+		log.Printf("bolt store: delete %q failed: %v", key, err)
+	}
+	return pair
+}
+
+// put is the shared coordinator-side write path for Set and Delete,
+// durably checkpointing versionCounter in the same transaction as the
+// write itself.
+func (b *BoltStore) put(key, value string, deleted bool, nodeID string, context VectorClock) (KVPair, error) {
+	var pair KVPair
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		counter := readVersionCounter(tx) + 1
+		if err := writeVersionCounter(tx, counter); err != nil {
+			return err
+		}
+
+		entry, err := getEntry(tx, key)
+		if err != nil {
+			return err
+		}
+
+		base := context
+		if base == nil {
+			base = VectorClock{}
+			for _, sibling := range entry.Siblings {
+				base = base.merge(sibling.Clock)
+			}
+		}
+		clock := base.clone()
+		clock[nodeID]++
+
+		pair = KVPair{Value: value, Version: counter, Clock: clock, AppliedAt: time.Now(), Deleted: deleted}
+		return putEntry(tx, key, kvEntry{Siblings: []KVPair{pair}})
+	})
+	return pair, err
+}
+
+// Merge applies an incoming replicated/repaired pair the same way
+// MemoryStore.Merge does, against whatever siblings are durably stored for
+// key.
+func (b *BoltStore) Merge(key string, incoming KVPair) []KVPair {
+	var kept []KVPair
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if incoming.Version > readVersionCounter(tx) {
+			if err := writeVersionCounter(tx, incoming.Version); err != nil {
+				return err
+			}
+		}
+		// AppliedAt is per-replica: stamp it with when *this* node
+		// committed the pair, not whatever time the sender used.
+		incoming.AppliedAt = time.Now()
+
+		entry, err := getEntry(tx, key)
+		if err != nil {
+			return err
+		}
+
+		dominated := false
+		kept = make([]KVPair, 0, len(entry.Siblings)+1)
+		for _, sibling := range entry.Siblings {
+			switch compareClocks(incoming.Clock, sibling.Clock) {
+			case clockAfter:
+				// incoming supersedes this sibling - drop it
+			case clockBefore:
+				dominated = true
+				kept = append(kept, sibling)
+			case clockEqual:
+				dominated = true
+				kept = append(kept, resolveEqualClock(incoming, sibling))
+			default: // concurrent
+				kept = append(kept, sibling)
+			}
+		}
+		if !dominated {
+			kept = append(kept, incoming)
+		}
+
+		return putEntry(tx, key, kvEntry{Siblings: kept})
+	})
+	if err != nil {
+		log.Printf("bolt store: merge %q failed: %v", key, err)
+	}
+	return kept
+}
+
+// Replace overwrites key's durably stored sibling set with siblings.
+func (b *BoltStore) Replace(key string, siblings []KVPair) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return putEntry(tx, key, kvEntry{Siblings: siblings})
+	})
+	if err != nil {
+		log.Printf("bolt store: replace %q failed: %v", key, err)
+	}
+}
+
+// Get retrieves every sibling durably stored for key.
+func (b *BoltStore) Get(key string) ([]KVPair, bool) {
+	var entry kvEntry
+	err := b.db.View(func(tx *bolt.Tx) error {
+		e, err := getEntry(tx, key)
+		entry = e
+		return err
+	})
+	if err != nil {
+		log.Printf("bolt store: get %q failed: %v", key, err)
+	}
+	if len(entry.Siblings) == 0 {
+		return nil, false
+	}
+	return append([]KVPair(nil), entry.Siblings...), true
+}
+
+// Scan returns every key's current sibling set.
+func (b *BoltStore) Scan() map[string][]KVPair {
+	out := map[string][]KVPair{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltKVBucket)).ForEach(func(k, v []byte) error {
+			var entry kvEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			out[string(k)] = entry.Siblings
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("bolt store: scan failed: %v", err)
+	}
+	return out
+}
+
+// Snapshot captures the full store state for persistence - used mainly to
+// hand data to a peer or another backend, since BoltStore is already
+// durable on its own.
+func (b *BoltStore) Snapshot() (KVSnapshot, error) {
+	snapshot := KVSnapshot{Entries: map[string][]KVPair{}}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		snapshot.VersionCounter = readVersionCounter(tx)
+		return tx.Bucket([]byte(boltKVBucket)).ForEach(func(k, v []byte) error {
+			var entry kvEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			snapshot.Entries[string(k)] = entry.Siblings
+			return nil
+		})
+	})
+	return snapshot, err
+}
+
+// Restore replaces the store's state with a previously captured snapshot.
+func (b *BoltStore) Restore(snapshot KVSnapshot) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(boltKVBucket)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		kvBucket, err := tx.CreateBucket([]byte(boltKVBucket))
+		if err != nil {
+			return err
+		}
+		for key, siblings := range snapshot.Entries {
+			data, err := json.Marshal(kvEntry{Siblings: siblings})
+			if err != nil {
+				return err
+			}
+			if err := kvBucket.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return writeVersionCounter(tx, snapshot.VersionCounter)
+	})
+}
+
+// VersionCounter returns the store's durable monotonic write counter.
+func (b *BoltStore) VersionCounter() int {
+	var v int
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v = readVersionCounter(tx)
+		return nil
+	})
+	if err != nil {
+		log.Printf("bolt store: read version counter failed: %v", err)
+	}
+	return v
+}
+
+// Close releases the underlying BoltDB file.
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// hintBucket is the sole bucket in the on-disk hint log. Keys are
+// "<peerURL>\x00<zero-padded seq>" so a bucket scan naturally yields FIFO
+// order per peer without a separate index, the same trick
+// leader-follower/hints.go uses against its own Store.
+const hintBucket = "hints"
+
+// hintMaxPerPeer bounds how many writes are queued for a single unreachable
+// peer before the oldest hint is dropped to make room, so a peer that's down
+// indefinitely can't grow the queue without limit.
+const hintMaxPerPeer = 10000
+
+// hint is one write a peer missed, queued for later replay.
+type hint struct {
+	TargetNode string    `json:"target_node"`
+	Key        string    `json:"key"`
+	Pair       KVPair    `json:"pair"`
+	Ts         time.Time `json:"ts"`
+	seq        int64     // recovered from the bolt key; not persisted in the value
+}
+
+// hintLog is the bounded on-disk queue of hinted-handoff writes, backed by
+// its own BoltDB file so queued writes survive a restart independently of
+// whichever KVStore backend (memory or bolt) the node's live data uses.
+type hintLog struct {
+	db *bolt.DB
+}
+
+// newHintLog opens (creating if necessary) a hint log at path.
+func newHintLog(path string) (*hintLog, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(hintBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &hintLog{db: db}, nil
+}
+
+// hintKey builds the bolt key a hint is stored under. The zero-padded
+// sequence keeps every peer's hints sorted FIFO by a plain bucket scan.
+func hintKey(peerURL string, seq int64) []byte {
+	return []byte(fmt.Sprintf("%s\x00%020d", peerURL, seq))
+}
+
+// parseHintKey recovers the peer URL and sequence number hintKey encoded.
+func parseHintKey(k []byte) (peerURL string, seq int64, ok bool) {
+	parts := strings.SplitN(string(k), "\x00", 2)
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	n, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], n, true
+}
+
+// Queue persists a write the coordinator couldn't deliver to peerURL,
+// evicting the oldest queued hint for that peer once its queue is already
+// at hintMaxPerPeer.
+func (hl *hintLog) Queue(peerURL, key string, pair KVPair) error {
+	return hl.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(hintBucket))
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		h := hint{TargetNode: peerURL, Key: key, Pair: pair, Ts: time.Now()}
+		data, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(hintKey(peerURL, int64(seq)), data); err != nil {
+			return err
+		}
+
+		return evictOldestOverCap(b, peerURL)
+	})
+}
+
+// evictOldestOverCap drops peerURL's oldest queued hint(s) until its queue
+// is back within hintMaxPerPeer. Callers must hold the enclosing transaction.
+func evictOldestOverCap(b *bolt.Bucket, peerURL string) error {
+	prefix := []byte(peerURL + "\x00")
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for len(keys) > hintMaxPerPeer {
+		if err := b.Delete(keys[0]); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// List returns every hint currently queued for peerURL, oldest first.
+func (hl *hintLog) List(peerURL string) ([]hint, error) {
+	var hints []hint
+	err := hl.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(hintBucket))
+		prefix := []byte(peerURL + "\x00")
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var h hint
+			if err := json.Unmarshal(v, &h); err != nil {
+				continue
+			}
+			_, h.seq, _ = parseHintKey(k)
+			hints = append(hints, h)
+		}
+		return nil
+	})
+	return hints, err
+}
+
+// Remove deletes the hint queued for peerURL at seq, used once it's been
+// successfully replayed.
+func (hl *hintLog) Remove(peerURL string, seq int64) error {
+	return hl.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(hintBucket)).Delete(hintKey(peerURL, seq))
+	})
+}
+
+// All returns every queued hint, grouped by target peer, for the
+// /admin/hints inspection endpoint.
+func (hl *hintLog) All() (map[string][]hint, error) {
+	out := make(map[string][]hint)
+	err := hl.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(hintBucket)).ForEach(func(k, v []byte) error {
+			peerURL, seq, ok := parseHintKey(k)
+			if !ok {
+				return nil
+			}
+			var h hint
+			if err := json.Unmarshal(v, &h); err != nil {
+				return nil
+			}
+			h.seq = seq
+			out[peerURL] = append(out[peerURL], h)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// Close releases the underlying BoltDB file.
+func (hl *hintLog) Close() error {
+	return hl.db.Close()
+}
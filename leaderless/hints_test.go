@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestHintLogQueueListRemove checks the basic FIFO round trip: queued hints
+// come back in order, and removing one leaves the rest untouched.
+func TestHintLogQueueListRemove(t *testing.T) {
+	hl, err := newHintLog(filepath.Join(t.TempDir(), "hints.db"))
+	if err != nil {
+		t.Fatalf("newHintLog failed: %v", err)
+	}
+	defer hl.Close()
+
+	peer := "http://peer1"
+	for i, v := range []string{"a", "b", "c"} {
+		if err := hl.Queue(peer, "key", KVPair{Value: v, Version: i + 1}); err != nil {
+			t.Fatalf("Queue failed: %v", err)
+		}
+	}
+
+	queued, err := hl.List(peer)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(queued) != 3 || queued[0].Pair.Value != "a" || queued[2].Pair.Value != "c" {
+		t.Fatalf("expected hints in FIFO order [a b c], got %+v", queued)
+	}
+
+	if err := hl.Remove(peer, queued[0].seq); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	remaining, err := hl.List(peer)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(remaining) != 2 || remaining[0].Pair.Value != "b" {
+		t.Fatalf("expected [b c] after removing the oldest hint, got %+v", remaining)
+	}
+}
+
+// TestHintLogEvictsOldestOverCap checks that queuing past hintMaxPerPeer
+// for one peer drops the oldest hint rather than growing without bound,
+// and leaves another peer's queue untouched.
+func TestHintLogEvictsOldestOverCap(t *testing.T) {
+	hl, err := newHintLog(filepath.Join(t.TempDir(), "hints.db"))
+	if err != nil {
+		t.Fatalf("newHintLog failed: %v", err)
+	}
+	defer hl.Close()
+
+	peer := "http://peer1"
+	for i := 0; i < hintMaxPerPeer+5; i++ {
+		if err := hl.Queue(peer, "key", KVPair{Version: i}); err != nil {
+			t.Fatalf("Queue failed: %v", err)
+		}
+	}
+	if err := hl.Queue("http://peer2", "key", KVPair{Version: 0}); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+
+	queued, err := hl.List(peer)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(queued) != hintMaxPerPeer {
+		t.Fatalf("expected queue capped at %d, got %d", hintMaxPerPeer, len(queued))
+	}
+	if queued[0].Pair.Version != 5 {
+		t.Fatalf("expected the oldest 5 hints evicted, first remaining version got %d", queued[0].Pair.Version)
+	}
+
+	other, err := hl.List("http://peer2")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(other) != 1 {
+		t.Fatalf("expected peer2's queue untouched by peer1's eviction, got %d entries", len(other))
+	}
+}
+
+// TestHintLogSurvivesRestart checks that queued hints are still present
+// after closing and reopening the same file, the same durability guarantee
+// BoltStore gives the live dataset.
+func TestHintLogSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hints.db")
+
+	hl, err := newHintLog(path)
+	if err != nil {
+		t.Fatalf("newHintLog failed: %v", err)
+	}
+	if err := hl.Queue("http://peer1", "key", KVPair{Value: "v", Version: 1}); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	if err := hl.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := newHintLog(path)
+	if err != nil {
+		t.Fatalf("reopening hint log failed: %v", err)
+	}
+	defer reopened.Close()
+
+	queued, err := reopened.List("http://peer1")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(queued) != 1 || queued[0].Pair.Value != "v" {
+		t.Fatalf("expected the queued hint to survive restart, got %+v", queued)
+	}
+}
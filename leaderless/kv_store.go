@@ -2,123 +2,544 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
+	mrand "math/rand"
 	"net/http"
+	"net/url"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// KVPair represents a key-value pair with version
+// KVPair represents a key-value pair. Version is a per-store write counter
+// kept for logging/debugging; Clock is authoritative for conflict
+// resolution between concurrent writes from different coordinators.
+// AppliedAt is per-replica - the wall-clock time *this* node locally applied
+// the pair - used to decide whether a bounded-staleness read can be served
+// from it.
 type KVPair struct {
-	Value   string `json:"value"`
-	Version int    `json:"version"`
+	Value     string      `json:"value"`
+	Version   int         `json:"version"`
+	Clock     VectorClock `json:"clock,omitempty"`
+	AppliedAt time.Time   `json:"applied_at,omitempty"`
+	// Deleted marks this pair as a tombstone, written by Txn's Delete op. A
+	// tombstone is a sibling like any other and reconciles via the same
+	// vector-clock rules, so a concurrent write elsewhere still surfaces as
+	// a sibling instead of silently resurrecting the old value.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
-// KVStore is an in-memory key-value store
-type KVStore struct {
-	store          map[string]KVPair
+// kvEntry holds every sibling version currently stored for a key. Siblings
+// appear when two coordinators write the same key concurrently (neither
+// clock dominates the other); len(Siblings) == 1 is the common case.
+type kvEntry struct {
+	Siblings []KVPair
+}
+
+// KVSnapshot is the durable unit Snapshot/Restore exchange: every key's
+// sibling set plus the monotonic versionCounter checkpoint it was captured
+// at, so a restart can recover both without replaying every write.
+type KVSnapshot struct {
+	VersionCounter int                 `json:"version_counter"`
+	Entries        map[string][]KVPair `json:"entries"`
+}
+
+// KVStore is the interface every storage backend (in-memory, persistent
+// BoltDB-backed, ...) must satisfy so LeaderlessNode can be wired up
+// without caring whether a restart loses the dataset.
+type KVStore interface {
+	Get(key string) ([]KVPair, bool)
+	Set(key, value, nodeID string, context VectorClock) KVPair
+	// Delete writes a tombstone for key, with the same context/clock-merge
+	// semantics as Set.
+	Delete(key, nodeID string, context VectorClock) KVPair
+	Merge(key string, incoming KVPair) []KVPair
+	// Replace overwrites key's stored sibling set with siblings, used by
+	// Compact to drop siblings that mergeSiblingSets has already determined
+	// are dominated.
+	Replace(key string, siblings []KVPair)
+	// Scan returns every key's current sibling set, for anti-entropy and
+	// the startup delta-sync against peers.
+	Scan() map[string][]KVPair
+	// Snapshot captures the full store state for persistence.
+	Snapshot() (KVSnapshot, error)
+	// Restore replaces the store's state with a previously captured
+	// snapshot, used to recover versionCounter and local data on startup.
+	Restore(snapshot KVSnapshot) error
+	VersionCounter() int
+}
+
+// MemoryStore is an in-memory KVStore. It's lost on every restart, which is
+// fine for tests but not for a node that needs to survive a crash - see
+// BoltStore for the persistent alternative.
+type MemoryStore struct {
+	store          map[string]kvEntry
 	mu             sync.RWMutex
 	versionCounter int
 }
 
-// NewKVStore creates a new KVStore
-func NewKVStore() *KVStore {
-	return &KVStore{
-		store:          make(map[string]KVPair),
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		store:          make(map[string]kvEntry),
 		versionCounter: 0,
 	}
 }
 
-// Set stores a key-value pair with optional version
-func (kv *KVStore) Set(key, value string, version *int) int {
+// Set performs a coordinator-side write: it merges context (the clock the
+// client read before writing, or nil if it has none) with whatever is
+// already stored, increments nodeID's own component, and replaces any
+// existing siblings with the single resulting value. This is how a client
+// that read siblings and picked one "resolves" them on its next write.
+func (kv *MemoryStore) Set(key, value, nodeID string, context VectorClock) KVPair {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	pair := kv.put(key, value, false, nodeID, context)
+	return pair
+}
+
+// Delete writes a tombstone for key, with the same context/clock-merge
+// semantics as Set.
+func (kv *MemoryStore) Delete(key, nodeID string, context VectorClock) KVPair {
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
+	return kv.put(key, "", true, nodeID, context)
+}
 
-	var v int
-	if version == nil {
-		// Leader writes: increment version
-		kv.versionCounter++
-		v = kv.versionCounter
-	} else {
-		// Follower replication: use provided version from leader
-		v = *version
-		if v > kv.versionCounter {
-			kv.versionCounter = v
+// put is the shared coordinator-side write path for Set and Delete: it
+// merges context with whatever is already stored, increments nodeID's own
+// clock component, and replaces any existing siblings with the single
+// resulting pair. Callers must hold kv.mu.
+func (kv *MemoryStore) put(key, value string, deleted bool, nodeID string, context VectorClock) KVPair {
+	kv.versionCounter++
+
+	base := context
+	if base == nil {
+		base = VectorClock{}
+		for _, sibling := range kv.store[key].Siblings {
+			base = base.merge(sibling.Clock)
 		}
 	}
+	clock := base.clone()
+	clock[nodeID]++
+
+	pair := KVPair{Value: value, Version: kv.versionCounter, Clock: clock, AppliedAt: time.Now(), Deleted: deleted}
+	kv.store[key] = kvEntry{Siblings: []KVPair{pair}}
+	return pair
+}
+
+// Merge applies an incoming replicated/repaired pair against whatever
+// siblings are already stored for key: a pair whose clock dominates an
+// existing sibling replaces it, a pair dominated by an existing sibling is
+// dropped, and a pair concurrent with every existing sibling is kept
+// alongside them. It returns the resulting sibling set.
+func (kv *MemoryStore) Merge(key string, incoming KVPair) []KVPair {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if incoming.Version > kv.versionCounter {
+		kv.versionCounter = incoming.Version
+	}
+	// AppliedAt is per-replica: stamp it with when *this* node committed
+	// the pair, not whatever time the originating coordinator sent.
+	incoming.AppliedAt = time.Now()
+
+	existing := kv.store[key].Siblings
+
+	kept := make([]KVPair, 0, len(existing)+1)
+	dominated := false
+	for _, sibling := range existing {
+		switch compareClocks(incoming.Clock, sibling.Clock) {
+		case clockAfter:
+			// incoming supersedes this sibling - drop it
+		case clockBefore:
+			dominated = true
+			kept = append(kept, sibling)
+		case clockEqual:
+			dominated = true
+			kept = append(kept, resolveEqualClock(incoming, sibling))
+		default: // concurrent
+			kept = append(kept, sibling)
+		}
+	}
+	if !dominated {
+		kept = append(kept, incoming)
+	}
+
+	kv.store[key] = kvEntry{Siblings: kept}
+	return kept
+}
 
-	kv.store[key] = KVPair{
-		Value:   value,
-		Version: v,
+// Replace overwrites key's stored sibling set with siblings.
+func (kv *MemoryStore) Replace(key string, siblings []KVPair) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.store[key] = kvEntry{Siblings: append([]KVPair(nil), siblings...)}
+}
+
+// Get retrieves every sibling stored for key.
+func (kv *MemoryStore) Get(key string) ([]KVPair, bool) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+
+	entry, exists := kv.store[key]
+	if !exists || len(entry.Siblings) == 0 {
+		return nil, false
 	}
+	return append([]KVPair(nil), entry.Siblings...), true
+}
+
+// Scan returns every key's current sibling set.
+func (kv *MemoryStore) Scan() map[string][]KVPair {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
 
-	return v
+	out := make(map[string][]KVPair, len(kv.store))
+	for key, entry := range kv.store {
+		out[key] = append([]KVPair(nil), entry.Siblings...)
+	}
+	return out
 }
 
-// Get retrieves a key-value pair
-func (kv *KVStore) Get(key string) (KVPair, bool) {
+// Snapshot captures the full store state for persistence.
+func (kv *MemoryStore) Snapshot() (KVSnapshot, error) {
 	kv.mu.RLock()
 	defer kv.mu.RUnlock()
 
-	pair, exists := kv.store[key]
-	return pair, exists
+	entries := make(map[string][]KVPair, len(kv.store))
+	for key, entry := range kv.store {
+		entries[key] = append([]KVPair(nil), entry.Siblings...)
+	}
+	return KVSnapshot{VersionCounter: kv.versionCounter, Entries: entries}, nil
+}
+
+// Restore replaces the store's state with a previously captured snapshot.
+func (kv *MemoryStore) Restore(snapshot KVSnapshot) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	store := make(map[string]kvEntry, len(snapshot.Entries))
+	for key, siblings := range snapshot.Entries {
+		store[key] = kvEntry{Siblings: append([]KVPair(nil), siblings...)}
+	}
+	kv.store = store
+	kv.versionCounter = snapshot.VersionCounter
+	return nil
+}
+
+// VersionCounter returns the store's monotonic write counter.
+func (kv *MemoryStore) VersionCounter() int {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+	return kv.versionCounter
+}
+
+// mergeSiblingSets reduces a pool of KVPairs (gathered from one or more
+// replicas) down to its non-dominated members: any pair that's
+// happened-before another pair in the pool is dropped, and duplicates
+// (equal value and clock) are collapsed.
+func mergeSiblingSets(pairs []KVPair) []KVPair {
+	var kept []KVPair
+	for _, candidate := range pairs {
+		dominated := false
+		for _, other := range pairs {
+			if compareClocks(other.Clock, candidate.Clock) == clockAfter {
+				dominated = true
+				break
+			}
+		}
+		if dominated {
+			continue
+		}
+
+		duplicate := false
+		for _, existing := range kept {
+			if existing.Value == candidate.Value && compareClocks(existing.Clock, candidate.Clock) == clockEqual {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+// ReadConsistency selects how LeaderlessNode.Read is allowed to satisfy a
+// read.
+type ReadConsistency string
+
+const (
+	// ConsistencyStrong is the existing read-quorum behavior (r==1 fast
+	// path or r>1 quorum-and-merge), gated on ln.r.
+	ConsistencyStrong ReadConsistency = "strong"
+	// ConsistencyBounded serves directly from any single replica (local
+	// preferred) whose siblings are all within the requested staleness,
+	// falling back to the quorum/local path above if none qualifies.
+	ConsistencyBounded ReadConsistency = "bounded"
+	// ConsistencyEventual serves directly from any single replica with no
+	// staleness check, bypassing the read quorum entirely.
+	ConsistencyEventual ReadConsistency = "eventual"
+)
+
+// ReplicaLevel picks how many replicas a single Write or Read must reach,
+// overriding the node's configured W/R for that one request - the classic
+// Dynamo ONE/QUORUM/ALL knob. It's orthogonal to ReadConsistency: that
+// selects *how* a read is served (quorum vs. a single fresh-enough
+// replica), this selects *how many* replicas a quorum write/read needs.
+type ReplicaLevel string
+
+const (
+	// LevelOne requires only the coordinator itself.
+	LevelOne ReplicaLevel = "one"
+	// LevelQuorum requires a strict majority of the cluster (this node plus
+	// every currently alive peer).
+	LevelQuorum ReplicaLevel = "quorum"
+	// LevelAll requires every node in the cluster.
+	LevelAll ReplicaLevel = "all"
+)
+
+// parseReplicaLevel validates s as a ReplicaLevel tag. An empty string is
+// valid and means "use the node's configured default".
+func parseReplicaLevel(s string) (ReplicaLevel, error) {
+	switch ReplicaLevel(s) {
+	case "", LevelOne, LevelQuorum, LevelAll:
+		return ReplicaLevel(s), nil
+	default:
+		return "", fmt.Errorf("unknown consistency level %q", s)
+	}
+}
+
+// replicaCount resolves lvl against totalNodes (this node plus every
+// currently alive peer), falling back to fallback (the node's configured W
+// or R) when lvl is empty.
+func (lvl ReplicaLevel) replicaCount(totalNodes, fallback int) int {
+	switch lvl {
+	case LevelOne:
+		return 1
+	case LevelQuorum:
+		return totalNodes/2 + 1
+	case LevelAll:
+		return totalNodes
+	default:
+		return fallback
+	}
 }
 
 // LeaderlessNode represents a node in the leaderless architecture
 type LeaderlessNode struct {
-	nodeID   string
-	kvStore  *KVStore
-	peerURLs []string
-	w        int // Write quorum
-	r        int // Read quorum
+	nodeID     string
+	kvStore    KVStore
+	membership Membership
+	w          int // Write quorum
+	r          int // Read quorum
+
+	// hints is the bounded on-disk queue of writes this node couldn't
+	// deliver to a peer at write time; RunHintedHandoff replays them once
+	// that peer is reachable again.
+	hints *hintLog
+
+	// readRepairs counts every pair readRepair has pushed to a replica
+	// (local merge or peer push), surfaced via /admin/hints so anti-entropy
+	// behavior can be measured alongside the stale-read rate.
+	readRepairs int64
+
+	// safeTimestamps is the max AppliedAt each peer has acked over
+	// /replicate, gossiped back on every ack, so a bounded-staleness read
+	// can pick a peer likely to qualify without guessing blindly.
+	safeTimestampsMu sync.RWMutex
+	safeTimestamps   map[string]time.Time
+
+	// txnMu is the shard mutex Txn takes for the duration of evaluating its
+	// compares and applying its chosen branch, so two concurrent
+	// transactions can't interleave a read of a stale sibling set with a
+	// write based on it.
+	txnMu sync.Mutex
+
+	// ae tracks each keyspace range's Merkle tree for RunAntiEntropy, so a
+	// peer down during a write (and never subsequently read) still
+	// converges eventually instead of diverging forever.
+	ae *antiEntropy
 }
 
-// NewLeaderlessNode creates a new leaderless node
-func NewLeaderlessNode(nodeID string, peerURLs []string, w, r int) *LeaderlessNode {
+// NewLeaderlessNode creates a new leaderless node backed by store, with
+// hints as its hinted-handoff queue and membership as the source of truth
+// for which peers to write/read from (see Membership - a cluster running
+// StaticMembership behaves exactly as before). Callers that already
+// recovered store from disk (see main.go's createKVStore) should still run
+// StartupSync afterwards to pull any writes peers accepted while this node
+// was down. antiEntropyRanges and antiEntropyDepth size the Merkle forest
+// RunAntiEntropy syncs against peers - see antiEntropy for what they
+// control.
+func NewLeaderlessNode(nodeID string, membership Membership, w, r int, store KVStore, hints *hintLog, antiEntropyRanges, antiEntropyDepth int) *LeaderlessNode {
 	return &LeaderlessNode{
-		nodeID:   nodeID,
-		kvStore:  NewKVStore(),
-		peerURLs: peerURLs,
-		w:        w,
-		r:        r,
+		nodeID:         nodeID,
+		kvStore:        store,
+		membership:     membership,
+		w:              w,
+		r:              r,
+		hints:          hints,
+		safeTimestamps: make(map[string]time.Time),
+		ae:             newAntiEntropy(antiEntropyRanges, antiEntropyDepth),
 	}
 }
 
-// Write performs a write operation - this node becomes the write coordinator
-func (ln *LeaderlessNode) Write(key, value string) (int, int, error) {
+// peers returns every peer this node currently believes is alive, per its
+// Membership layer.
+func (ln *LeaderlessNode) peers() []string {
+	return ln.membership.AliveNodes()
+}
+
+// maxVersion returns the highest Version among siblings, or 0 for an empty
+// set.
+func maxVersion(siblings []KVPair) int {
+	version := 0
+	for _, p := range siblings {
+		if p.Version > version {
+			version = p.Version
+		}
+	}
+	return version
+}
+
+// maxVersionPair returns the sibling with the highest Version among
+// siblings, or the zero KVPair for an empty set.
+func maxVersionPair(siblings []KVPair) KVPair {
+	var max KVPair
+	for _, p := range siblings {
+		if p.Version > max.Version {
+			max = p
+		}
+	}
+	return max
+}
+
+// markKeyDirty folds key's current max sibling version and value into its
+// anti-entropy Merkle tree, called after every local mutation (Set, Merge,
+// Delete) so the tree stays incrementally up to date instead of being
+// rebuilt wholesale on next access.
+func (ln *LeaderlessNode) markKeyDirty(key string) {
+	siblings, _ := ln.kvStore.Get(key)
+	pair := maxVersionPair(siblings)
+	ln.ae.updateKey(key, pair.Value, pair.Version)
+}
+
+// Write performs a write operation - this node becomes the write
+// coordinator. context is the vector clock the client read before issuing
+// this write (decoded from the opaque token it got from /get), or nil if
+// it has none, in which case the coordinator merges whatever siblings it
+// already has for key. level overrides the node's configured W for this
+// write alone; an empty level keeps the existing behavior.
+func (ln *LeaderlessNode) Write(key, value string, context VectorClock, level ReplicaLevel) (int, KVPair, error) {
 	if key == "" {
-		return 400, 0, fmt.Errorf("key cannot be empty")
+		return 400, KVPair{}, fmt.Errorf("key cannot be empty")
+	}
+
+	if ln.membership.Role() == roleProxy {
+		return ln.forwardSet(key, value, context, level)
 	}
 
+	peers := ln.peers()
+	w := level.replicaCount(len(peers)+1, ln.w)
+
 	// Coordinator writes locally first
-	version := ln.kvStore.Set(key, value, nil)
+	pair := ln.kvStore.Set(key, value, ln.nodeID, context)
+	ln.markKeyDirty(key)
 	successfulWrites := 1 // Self
 
-	// Replicate to all peers (W=N configuration)
-	for _, peerURL := range ln.peerURLs {
+	// Replicate to all peers regardless of w, so every reachable replica
+	// stays current even when w only requires a subset to ack.
+	for _, peerURL := range peers {
 		// Simulate network delay
 		time.Sleep(200 * time.Millisecond)
 
-		if err := ln.replicateToPeer(peerURL, key, value, version); err == nil {
+		if err := ln.replicateToPeer(peerURL, key, pair); err == nil {
 			successfulWrites++
+		} else {
+			ln.queueHint(peerURL, key, pair)
 		}
 	}
 
-	// W=N: All nodes must write successfully
-	if successfulWrites >= ln.w {
-		return 201, version, nil
+	if successfulWrites >= w {
+		return 201, pair, nil
+	}
+
+	return 500, pair, fmt.Errorf("failed to meet write quorum")
+}
+
+// CAS performs a compare-and-swap: it gathers key's current version from r
+// replicas (the same quorum-read fan-out Read's r>1 path uses), aborting
+// with 409 the moment any replica reports a version newer than
+// expectedVersion, and otherwise proceeds with a normal quorum Write of
+// newValue. This differs from Txn's compare (which only checks this
+// coordinator's own local siblings): gathering r replicas means a
+// coordinator that's behind on anti-entropy can't silently clobber a
+// write another coordinator already got acknowledged. level overrides the
+// node's configured R for the version check and W for the follow-up write;
+// an empty level keeps the node's configured defaults for both.
+func (ln *LeaderlessNode) CAS(key string, expectedVersion int, newValue string, level ReplicaLevel) (int, KVPair, error) {
+	if key == "" {
+		return 400, KVPair{}, fmt.Errorf("key cannot be empty")
+	}
+
+	if ln.membership.Role() == roleProxy {
+		return ln.forwardCas(key, expectedVersion, newValue, level)
+	}
+
+	peers := ln.peers()
+	totalNodes := len(peers) + 1
+	r := level.replicaCount(totalNodes, ln.r)
+
+	type versionResult struct {
+		version int
+		found   bool
+	}
+	results := make(chan versionResult, totalNodes)
+
+	go func() {
+		siblings, exists := ln.kvStore.Get(key)
+		results <- versionResult{version: maxVersion(siblings), found: exists}
+	}()
+	for _, peerURL := range peers {
+		peerURL := peerURL // capture for goroutine
+		go func() {
+			siblings, err := ln.readFromPeer(peerURL, key)
+			results <- versionResult{version: maxVersion(siblings), found: err == nil}
+		}()
+	}
+
+	observed := 0
+	for i := 0; i < totalNodes && observed < r; i++ {
+		result := <-results
+		if !result.found {
+			continue
+		}
+		observed++
+		if result.version > expectedVersion {
+			return 409, KVPair{}, fmt.Errorf("observed version %d exceeds expected version %d", result.version, expectedVersion)
+		}
+	}
+
+	if observed < r {
+		return 500, KVPair{}, fmt.Errorf("failed to meet read quorum for CAS check: got %d/%d", observed, r)
 	}
 
-	return 500, version, fmt.Errorf("failed to meet write quorum")
+	return ln.Write(key, newValue, nil, level)
 }
 
 // replicateToPeer sends replication request to a peer
-func (ln *LeaderlessNode) replicateToPeer(peerURL, key, value string, version int) error {
+func (ln *LeaderlessNode) replicateToPeer(peerURL, key string, pair KVPair) error {
 	payload := map[string]interface{}{
 		"key":     key,
-		"value":   value,
-		"version": version,
+		"value":   pair.Value,
+		"version": pair.Version,
+		"clock":   pair.Clock,
+		"deleted": pair.Deleted,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -140,119 +561,1028 @@ func (ln *LeaderlessNode) replicateToPeer(peerURL, key, value string, version in
 		return fmt.Errorf("replication failed with status %d", resp.StatusCode)
 	}
 
+	var ack struct {
+		AppliedAt time.Time `json:"applied_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ack); err == nil {
+		ln.recordSafeTimestamp(peerURL, ack.AppliedAt)
+	}
+
 	return nil
 }
 
-// Read performs a read operation with quorum support
-func (ln *LeaderlessNode) Read(key string) (int, string, int, error) {
+// recordSafeTimestamp folds a peer's gossiped applied-at time into its safe
+// timestamp, which only ever moves forward (acks can arrive out of order
+// under concurrent replication).
+func (ln *LeaderlessNode) recordSafeTimestamp(peerURL string, appliedAt time.Time) {
+	if appliedAt.IsZero() {
+		return
+	}
+	ln.safeTimestampsMu.Lock()
+	defer ln.safeTimestampsMu.Unlock()
+	if appliedAt.After(ln.safeTimestamps[peerURL]) {
+		ln.safeTimestamps[peerURL] = appliedAt
+	}
+}
+
+// freshestPeers returns the currently alive peers ordered by descending
+// gossiped safe timestamp, so a bounded/eventual read tries the peer most
+// likely to satisfy it first instead of guessing.
+func (ln *LeaderlessNode) freshestPeers() []string {
+	ln.safeTimestampsMu.RLock()
+	defer ln.safeTimestampsMu.RUnlock()
+
+	urls := append([]string(nil), ln.peers()...)
+	sort.Slice(urls, func(i, j int) bool {
+		return ln.safeTimestamps[urls[i]].After(ln.safeTimestamps[urls[j]])
+	})
+	return urls
+}
+
+// readFromFreshReplica tries to answer a bounded-staleness or eventual read
+// directly from a single replica (local first, then peers ordered by
+// gossiped freshness), skipping the read quorum entirely. ok is false when
+// no replica could satisfy the request, meaning the caller should fall back
+// to Read's normal strong-consistency path.
+func (ln *LeaderlessNode) readFromFreshReplica(key string, consistency ReadConsistency, staleness time.Duration) (status int, pairs []KVPair, ok bool) {
+	fresh := func(pairs []KVPair, exists bool) bool {
+		if !exists || len(pairs) == 0 {
+			return false
+		}
+		if consistency != ConsistencyBounded {
+			return true
+		}
+		for _, p := range pairs {
+			if time.Since(p.AppliedAt) > staleness {
+				return false
+			}
+		}
+		return true
+	}
+
+	if local, exists := ln.kvStore.Get(key); fresh(local, exists) {
+		return 200, local, true
+	}
+
+	for _, peerURL := range ln.freshestPeers() {
+		if consistency == ConsistencyBounded {
+			ln.safeTimestampsMu.RLock()
+			safe := ln.safeTimestamps[peerURL]
+			ln.safeTimestampsMu.RUnlock()
+			if safe.IsZero() || time.Since(safe) > staleness {
+				continue // gossip already says this peer can't qualify
+			}
+		}
+
+		peerPairs, err := ln.readFromPeer(peerURL, key)
+		if err != nil {
+			continue
+		}
+		if fresh(peerPairs, len(peerPairs) > 0) {
+			return 200, peerPairs, true
+		}
+	}
+
+	return 0, nil, false
+}
+
+// Read performs a read operation with quorum support. It returns every
+// unreconciled sibling for key: len==1 in the common case, len>1 when
+// concurrent writes from different coordinators haven't been resolved yet.
+// consistency selects how it's allowed to answer: ConsistencyStrong always
+// does the r==1/quorum behavior below; ConsistencyBounded and
+// ConsistencyEventual first try a single replica (staleness is only
+// checked for ConsistencyBounded) before falling back to it. level
+// overrides the node's configured R for the quorum path alone; an empty
+// level keeps the existing behavior.
+func (ln *LeaderlessNode) Read(key string, consistency ReadConsistency, staleness time.Duration, level ReplicaLevel) (int, []KVPair, error) {
+	if ln.membership.Role() == roleProxy {
+		return ln.forwardGet(key, consistency, staleness, level)
+	}
+
+	if consistency == ConsistencyBounded || consistency == ConsistencyEventual {
+		if status, pairs, ok := ln.readFromFreshReplica(key, consistency, staleness); ok {
+			return status, pairs, nil
+		}
+	}
+
+	peers := ln.peers()
+	totalNodes := len(peers) + 1
+	r := level.replicaCount(totalNodes, ln.r)
+
 	// R=1: Fast path - only read from local
-	if ln.r == 1 {
-		pair, exists := ln.kvStore.Get(key)
+	if r == 1 {
+		pairs, exists := ln.kvStore.Get(key)
 		if !exists {
-			return 404, "", 0, fmt.Errorf("key not found")
+			return 404, nil, fmt.Errorf("key not found")
 		}
-		return 200, pair.Value, pair.Version, nil
+		return 200, pairs, nil
 	}
 
-	// R>1: Read from multiple nodes and return latest version
+	// R>1: Read from multiple nodes and merge their sibling sets
 	type readResult struct {
-		pair  KVPair
+		pairs []KVPair
 		found bool
-		err   error
 	}
 
-	results := make(chan readResult, len(ln.peerURLs)+1)
+	results := make(chan readResult, totalNodes)
 
 	// Read from local node
 	go func() {
-		pair, exists := ln.kvStore.Get(key)
-		results <- readResult{pair: pair, found: exists, err: nil}
+		pairs, exists := ln.kvStore.Get(key)
+		results <- readResult{pairs: pairs, found: exists}
 	}()
 
 	// Read from peer nodes in parallel
-	for _, peerURL := range ln.peerURLs {
+	for _, peerURL := range peers {
 		peerURL := peerURL // capture for goroutine
 		go func() {
-			pair, err := ln.readFromPeer(peerURL, key)
-			if err != nil {
-				results <- readResult{found: false, err: err}
-			} else {
-				results <- readResult{pair: pair, found: true, err: nil}
-			}
+			pairs, err := ln.readFromPeer(peerURL, key)
+			results <- readResult{pairs: pairs, found: err == nil}
 		}()
 	}
 
 	// Collect R responses
-	var validPairs []KVPair
+	var all []KVPair
 	nodesRead := 0
-	totalNodes := len(ln.peerURLs) + 1
 
-	for i := 0; i < totalNodes && nodesRead < ln.r; i++ {
+	for i := 0; i < totalNodes && nodesRead < r; i++ {
 		result := <-results
 		if result.found {
-			validPairs = append(validPairs, result.pair)
+			all = append(all, result.pairs...)
 			nodesRead++
 		}
 	}
 
 	// Check if R requirement is met
-	if nodesRead < ln.r {
-		return 500, "", 0, fmt.Errorf("failed to meet read quorum: got %d/%d", nodesRead, ln.r)
+	if nodesRead < r {
+		return 500, nil, fmt.Errorf("failed to meet read quorum: got %d/%d", nodesRead, r)
 	}
 
-	// Return the value with highest version (Last-Write-Wins)
-	if len(validPairs) == 0 {
-		return 404, "", 0, fmt.Errorf("key not found")
+	if len(all) == 0 {
+		return 404, nil, fmt.Errorf("key not found")
 	}
 
-	latest := validPairs[0]
-	for _, pair := range validPairs[1:] {
-		if pair.Version > latest.Version {
-			latest = pair
+	merged := mergeSiblingSets(all)
+
+	go ln.readRepair(key)
+
+	return 200, merged, nil
+}
+
+// readRepair re-reads key from every replica (local and peers), merges
+// their sibling sets, and pushes any pair a replica is missing so later
+// reads converge without needing another client-driven read. It runs in
+// the background after a quorum read returns, so it never adds latency to
+// the client-facing request.
+func (ln *LeaderlessNode) readRepair(key string) {
+	type replica struct {
+		peerURL string // "" for local
+		pairs   []KVPair
+		found   bool
+	}
+
+	replicas := make([]replica, 0, len(ln.peers())+1)
+
+	if pairs, exists := ln.kvStore.Get(key); exists {
+		replicas = append(replicas, replica{pairs: pairs, found: true})
+	}
+	for _, peerURL := range ln.peers() {
+		if pairs, err := ln.readFromPeer(peerURL, key); err == nil {
+			replicas = append(replicas, replica{peerURL: peerURL, pairs: pairs, found: true})
+		} else {
+			replicas = append(replicas, replica{peerURL: peerURL, found: false})
 		}
 	}
 
-	return 200, latest.Value, latest.Version, nil
+	if len(replicas) == 0 {
+		return
+	}
+
+	var all []KVPair
+	for _, r := range replicas {
+		all = append(all, r.pairs...)
+	}
+	merged := mergeSiblingSets(all)
+
+	for _, r := range replicas {
+		for _, winner := range merged {
+			if containsPair(r.pairs, winner) {
+				continue
+			}
+			atomic.AddInt64(&ln.readRepairs, 1)
+			if r.peerURL == "" {
+				ln.kvStore.Merge(key, winner)
+				ln.markKeyDirty(key)
+				continue
+			}
+			if err := ln.replicateToPeer(r.peerURL, key, winner); err != nil {
+				log.Printf("read repair: failed to push %s to %s: %v", key, r.peerURL, err)
+			}
+		}
+	}
 }
 
-// readFromPeer reads a key from a peer node
-func (ln *LeaderlessNode) readFromPeer(peerURL, key string) (KVPair, error) {
+// containsPair reports whether pairs already holds a value equal to target
+// (same value, equal clock).
+func containsPair(pairs []KVPair, target KVPair) bool {
+	for _, p := range pairs {
+		if p.Value == target.Value && compareClocks(p.Clock, target.Clock) == clockEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// readFromPeer reads every sibling for key from a peer node
+func (ln *LeaderlessNode) readFromPeer(peerURL, key string) ([]KVPair, error) {
 	resp, err := http.Get(peerURL + "/local_read/" + key)
 	if err != nil {
-		return KVPair{}, err
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("read failed with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Siblings []KVPair `json:"siblings"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result.Siblings, nil
+}
+
+// forwardTarget picks a random alive replica for a proxy node to forward a
+// client request to, load-balancing across whichever replicas are
+// currently up instead of always hitting the same one.
+func (ln *LeaderlessNode) forwardTarget() (string, error) {
+	replicas := ln.peers()
+	if len(replicas) == 0 {
+		return "", fmt.Errorf("proxy: no replicas available to forward to")
+	}
+	return replicas[mrand.Intn(len(replicas))], nil
+}
+
+// forwardSet forwards a proxy's Write to a randomly chosen replica's /set,
+// so a proxy can answer client writes without holding any data itself.
+func (ln *LeaderlessNode) forwardSet(key, value string, context VectorClock, level ReplicaLevel) (int, KVPair, error) {
+	target, err := ln.forwardTarget()
+	if err != nil {
+		return 500, KVPair{}, err
+	}
+
+	payload := map[string]interface{}{
+		"key":         key,
+		"value":       value,
+		"context":     encodeContext(context),
+		"consistency": string(level),
+	}
+	jsonData, _ := json.Marshal(payload)
+
+	resp, err := http.Post(target+"/set", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 502, KVPair{}, fmt.Errorf("proxy: forwarding write to %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Version int    `json:"version"`
+		Context string `json:"context"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != 201 {
+		return resp.StatusCode, KVPair{}, fmt.Errorf("proxy: %s rejected write with status %d", target, resp.StatusCode)
+	}
+
+	clock, _ := decodeContext(result.Context)
+	return resp.StatusCode, KVPair{Value: value, Version: result.Version, Clock: clock}, nil
+}
+
+// forwardGet forwards a proxy's Read to a randomly chosen replica's /get,
+// carrying the same consistency/staleness/level knobs a replica would have
+// applied locally.
+func (ln *LeaderlessNode) forwardGet(key string, consistency ReadConsistency, staleness time.Duration, level ReplicaLevel) (int, []KVPair, error) {
+	target, err := ln.forwardTarget()
+	if err != nil {
+		return 500, nil, err
+	}
+
+	v := url.Values{}
+	switch {
+	case consistency == ConsistencyBounded:
+		v.Set("staleness", staleness.String())
+	case consistency == ConsistencyEventual:
+		v.Set("consistency", "eventual")
+	case level != "":
+		v.Set("consistency", string(level))
+	}
+
+	resp, err := http.Get(target + "/get/" + key + "?" + v.Encode())
+	if err != nil {
+		return 502, nil, fmt.Errorf("proxy: forwarding read to %s: %w", target, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return KVPair{}, fmt.Errorf("read failed with status %d", resp.StatusCode)
+		return resp.StatusCode, nil, fmt.Errorf("key not found")
 	}
 
 	var result struct {
-		Value   string `json:"value"`
+		Siblings []KVPair `json:"siblings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 500, nil, err
+	}
+	return resp.StatusCode, result.Siblings, nil
+}
+
+// forwardCas forwards a proxy's CAS to a randomly chosen replica's /cas.
+func (ln *LeaderlessNode) forwardCas(key string, expectedVersion int, newValue string, level ReplicaLevel) (int, KVPair, error) {
+	target, err := ln.forwardTarget()
+	if err != nil {
+		return 500, KVPair{}, err
+	}
+
+	payload := map[string]interface{}{
+		"key":              key,
+		"expected_version": expectedVersion,
+		"new_value":        newValue,
+		"consistency":      string(level),
+	}
+	jsonData, _ := json.Marshal(payload)
+
+	resp, err := http.Post(target+"/cas", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 502, KVPair{}, fmt.Errorf("proxy: forwarding CAS to %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
 		Version int    `json:"version"`
+		Context string `json:"context"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != 201 {
+		return resp.StatusCode, KVPair{}, fmt.Errorf("proxy: %s rejected CAS with status %d", target, resp.StatusCode)
+	}
+
+	clock, _ := decodeContext(result.Context)
+	return resp.StatusCode, KVPair{Value: newValue, Version: result.Version, Clock: clock}, nil
+}
+
+// queueHint records a write this node couldn't deliver to peerURL so the
+// hinted-handoff sweeper can replay it once that peer recovers.
+func (ln *LeaderlessNode) queueHint(peerURL, key string, pair KVPair) {
+	if err := ln.hints.Queue(peerURL, key, pair); err != nil {
+		log.Printf("hinted handoff: failed to queue hint for %s: %v", peerURL, err)
+	}
+}
+
+// Hints returns a snapshot of the current hint queues, keyed by target peer,
+// for the /admin/hints inspection endpoint.
+func (ln *LeaderlessNode) Hints() map[string][]hint {
+	snapshot, err := ln.hints.All()
+	if err != nil {
+		log.Printf("hinted handoff: failed to list hints: %v", err)
+		return map[string][]hint{}
 	}
+	return snapshot
+}
+
+// ReadRepairs reports how many pairs readRepair has pushed to a replica so
+// far, for the /admin/hints endpoint.
+func (ln *LeaderlessNode) ReadRepairs() int64 {
+	return atomic.LoadInt64(&ln.readRepairs)
+}
+
+// Members reports every member this node's Membership layer currently
+// knows about (any state), for the /members endpoint.
+func (ln *LeaderlessNode) Members() []member {
+	return ln.membership.Members()
+}
+
+// RunHintedHandoff periodically checks each peer's /health and, once a peer
+// that has queued hints answers, drains its queue in FIFO order. It never
+// returns; callers start it with `go`.
+func (ln *LeaderlessNode) RunHintedHandoff(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		ln.drainReadyPeers()
+	}
+}
 
+// drainReadyPeers attempts one drain pass over every peer with a queued
+// hint and a reachable /health, used by both RunHintedHandoff's timer and
+// the /admin/hints/flush endpoint's on-demand sweep.
+func (ln *LeaderlessNode) drainReadyPeers() {
+	for _, peerURL := range ln.peers() {
+		queued, err := ln.hints.List(peerURL)
+		if err != nil || len(queued) == 0 {
+			continue
+		}
+		if !ln.peerHealthy(peerURL) {
+			continue
+		}
+		ln.drainHints(peerURL)
+	}
+}
+
+// FlushHints forces an immediate drain attempt against every peer with a
+// queued hint, instead of waiting for RunHintedHandoff's next tick. Used by
+// the /admin/hints/flush endpoint.
+func (ln *LeaderlessNode) FlushHints() {
+	ln.drainReadyPeers()
+}
+
+// peerHealthy reports whether peerURL's /health endpoint is currently
+// reachable.
+func (ln *LeaderlessNode) peerHealthy(peerURL string) bool {
+	resp, err := http.Get(peerURL + "/health")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == 200
+}
+
+// drainHints replays every queued hint for peerURL in FIFO order, stopping
+// (and keeping the rest queued) at the first failure.
+func (ln *LeaderlessNode) drainHints(peerURL string) {
+	queue, err := ln.hints.List(peerURL)
+	if err != nil {
+		log.Printf("hinted handoff: failed to list hints for %s: %v", peerURL, err)
+		return
+	}
+
+	for _, next := range queue {
+		if err := ln.replicateToPeer(peerURL, next.Key, next.Pair); err != nil {
+			log.Printf("hinted handoff: %s still unreachable, keeping remaining hints queued: %v", peerURL, err)
+			return
+		}
+		if err := ln.hints.Remove(peerURL, next.seq); err != nil {
+			log.Printf("hinted handoff: failed to clear delivered hint for %s: %v", peerURL, err)
+		}
+	}
+}
+
+// MerkleNode reports the Merkle tree node this node holds at (depth,
+// index) within keyspace range rng, along with the keys in that bucket if
+// depth is 0 (the leaf/bucket level) - what a syncing peer needs once it's
+// narrowed a mismatch down that far. ok is false if depth/index is out of
+// range for this node's configured tree depth.
+func (ln *LeaderlessNode) MerkleNode(rng, depth, index int) (hash merkleHash, keys []string, ok bool) {
+	tree := ln.ae.treeForRange(rng, ln.VersionedKeys)
+	h, ok := tree.nodeAt(depth, index)
+	if !ok {
+		return merkleHash{}, nil, false
+	}
+	if depth == 0 {
+		keys = tree.keysInBucket(index)
+	}
+	return h, keys, true
+}
+
+// RunAntiEntropy periodically picks a random peer and a random keyspace
+// range, compares Merkle roots over /merkle, and on a mismatch descends
+// into only the diverging subtrees to find the specific divergent keys,
+// then reconciles them - so a peer that was down during a write nobody
+// ever re-reads still converges eventually instead of diverging forever.
+// It never returns; callers start it with `go`.
+func (ln *LeaderlessNode) RunAntiEntropy(interval time.Duration) {
+	rnd := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	for {
+		time.Sleep(interval)
+
+		if len(ln.peers()) == 0 {
+			continue
+		}
+		peerURL := ln.peers()[rnd.Intn(len(ln.peers()))]
+		keyRange := rnd.Intn(ln.ae.numRanges)
+		ln.syncRange(peerURL, keyRange)
+	}
+}
+
+// syncRange compares this node's Merkle root for keyRange against
+// peerURL's, and descends into the mismatching subtrees if they differ.
+func (ln *LeaderlessNode) syncRange(peerURL string, keyRange int) {
+	local := ln.ae.treeForRange(keyRange, ln.VersionedKeys)
+
+	remoteHash, _, ok := ln.fetchMerkleNode(peerURL, keyRange, local.depth, 0)
+	if !ok || remoteHash == local.root() {
+		return // peer unreachable, or this range is already in sync
+	}
+
+	ln.descendMerkle(peerURL, keyRange, local, local.depth, 0)
+}
+
+// descendMerkle compares the node at (depth, index) between local and
+// peerURL's tree for keyRange, recursing into both children on a mismatch
+// until depth 0 (the bucket/leaf level), where it reconciles whichever
+// keys either side reports for that bucket.
+func (ln *LeaderlessNode) descendMerkle(peerURL string, keyRange int, local *merkleTree, depth, index int) {
+	localHash, ok := local.nodeAt(depth, index)
+	if !ok {
+		return
+	}
+	remoteHash, remoteKeys, ok := ln.fetchMerkleNode(peerURL, keyRange, depth, index)
+	if !ok || remoteHash == localHash {
+		return
+	}
+
+	if depth == 0 {
+		keys := append([]string(nil), local.keysInBucket(index)...)
+		keys = append(keys, remoteKeys...)
+		for _, key := range dedupeStrings(keys) {
+			ln.reconcileKey(peerURL, key)
+		}
+		return
+	}
+
+	ln.descendMerkle(peerURL, keyRange, local, depth-1, 2*index)
+	ln.descendMerkle(peerURL, keyRange, local, depth-1, 2*index+1)
+}
+
+// reconcileKey pulls peerURL's siblings for key, merges them into this
+// node's store, and pushes back whatever the merge produced that peerURL
+// didn't already have - the same merge-then-push behavior readRepair uses
+// for a single read, just triggered by anti-entropy instead.
+func (ln *LeaderlessNode) reconcileKey(peerURL, key string) {
+	peerPairs, err := ln.readFromPeer(peerURL, key)
+	if err != nil {
+		return
+	}
+	for _, p := range peerPairs {
+		ln.kvStore.Merge(key, p)
+		ln.markKeyDirty(key)
+	}
+
+	merged, exists := ln.kvStore.Get(key)
+	if !exists {
+		return
+	}
+	for _, p := range merged {
+		if containsPair(peerPairs, p) {
+			continue
+		}
+		if err := ln.replicateToPeer(peerURL, key, p); err != nil {
+			log.Printf("anti-entropy: failed to push %s to %s: %v", key, peerURL, err)
+		}
+	}
+}
+
+// dedupeStrings returns in with duplicate entries collapsed, preserving
+// first-seen order.
+func dedupeStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// fetchMerkleNode fetches the Merkle tree node peerURL holds at (depth,
+// index) within keyspace range keyRange. ok is false if peerURL is
+// unreachable or doesn't have a node at that coordinate.
+func (ln *LeaderlessNode) fetchMerkleNode(peerURL string, keyRange, depth, index int) (merkleHash, []string, bool) {
+	resp, err := http.Get(fmt.Sprintf("%s/merkle/%d/%d/%d", peerURL, keyRange, depth, index))
+	if err != nil {
+		return merkleHash{}, nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return merkleHash{}, nil, false
+	}
+
+	var result struct {
+		Hash string   `json:"hash"`
+		Keys []string `json:"keys,omitempty"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return KVPair{}, err
+		return merkleHash{}, nil, false
 	}
 
-	return KVPair{Value: result.Value, Version: result.Version}, nil
+	raw, err := hex.DecodeString(result.Hash)
+	var h merkleHash
+	if err != nil || len(raw) != len(h) {
+		return merkleHash{}, nil, false
+	}
+	copy(h[:], raw)
+	return h, result.Keys, true
 }
 
-// Replicate handles replication request from another node
-func (ln *LeaderlessNode) Replicate(key, value string, version int) int {
+// Replicate handles replication request from another node. The returned
+// time is this node's AppliedAt for the write, piggybacked on the ack so
+// the coordinator can gossip a per-peer safe timestamp for bounded-staleness
+// reads without a separate round trip.
+func (ln *LeaderlessNode) Replicate(key string, pair KVPair) (int, time.Time) {
 	// Simulate write delay
 	time.Sleep(100 * time.Millisecond)
 
-	ln.kvStore.Set(key, value, &version)
-	return 201
+	appliedAt := time.Now()
+	ln.kvStore.Merge(key, pair)
+	ln.markKeyDirty(key)
+	return 201, appliedAt
 }
 
-// LocalRead performs a local read (for testing inconsistency)
-func (ln *LeaderlessNode) LocalRead(key string) (int, string, int, error) {
-	pair, exists := ln.kvStore.Get(key)
+// LocalRead performs a local read (for testing inconsistency), returning
+// every sibling stored for key.
+func (ln *LeaderlessNode) LocalRead(key string) (int, []KVPair, error) {
+	pairs, exists := ln.kvStore.Get(key)
 	if !exists {
-		return 404, "", 0, fmt.Errorf("key not found")
+		return 404, nil, fmt.Errorf("key not found")
+	}
+	return 200, pairs, nil
+}
+
+// TxnCompare is one predicate in a Txn's compare list, modeled on etcd's
+// compare-and-swap. Exactly one of ExpectedVersion/ExpectedValue/Exists
+// should be set; Key is evaluated against this coordinator's local siblings.
+// If key currently has more than one unreconciled sibling, ExpectedVersion
+// and ExpectedValue always fail - there's no single value to compare
+// against until a client resolves the conflict with a Get and a follow-up
+// write.
+type TxnCompare struct {
+	Key             string  `json:"key"`
+	ExpectedVersion *int    `json:"expected_version,omitempty"`
+	ExpectedValue   *string `json:"expected_value,omitempty"`
+	Exists          *bool   `json:"exists,omitempty"`
+}
+
+// TxnOp is one operation in a Txn's then/else branch. Exactly one of
+// Put/Delete/Get must be set.
+type TxnOp struct {
+	Put    *TxnPut    `json:"put,omitempty"`
+	Delete *TxnDelete `json:"delete,omitempty"`
+	Get    *TxnGet    `json:"get,omitempty"`
+}
+
+// TxnPut sets Key to Value, the same as a regular Write.
+type TxnPut struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// TxnDelete tombstones Key, the same as KVStore.Delete.
+type TxnDelete struct {
+	Key string `json:"key"`
+}
+
+// TxnGet reads Key's current siblings without mutating them.
+type TxnGet struct {
+	Key string `json:"key"`
+}
+
+// TxnOpResult is one op's outcome, in the same order as the ops in the
+// branch that ran. Siblings is empty for a Put/Delete (which always
+// resolve to a single new pair) and populated for a Get that found more
+// than one unreconciled sibling.
+type TxnOpResult struct {
+	Key      string   `json:"key"`
+	Value    string   `json:"value,omitempty"`
+	Version  int      `json:"version,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty"`
+	Siblings []KVPair `json:"siblings,omitempty"`
+}
+
+// TxnRequest is a compare-and-swap transaction: if every Compare holds,
+// Then runs; otherwise Else runs.
+type TxnRequest struct {
+	Compares []TxnCompare `json:"compares"`
+	Then     []TxnOp      `json:"then"`
+	Else     []TxnOp      `json:"else"`
+}
+
+// TxnResponse reports which branch ran and that branch's op results, in
+// the same shape etcd's KV.Txn returns.
+type TxnResponse struct {
+	Succeeded bool          `json:"succeeded"`
+	Responses []TxnOpResult `json:"responses"`
+}
+
+// Txn evaluates req's compares against this coordinator's local siblings
+// under txnMu, applies the chosen branch's ops locally with a single new
+// version number per op, and replicates each mutating op to peers under
+// the existing W-quorum rules before returning. As with LeaderNode.Txn,
+// ops replicate one-by-one rather than as a single atomic batch, so a
+// quorum failure partway through a multi-op branch can leave it partially
+// applied.
+func (ln *LeaderlessNode) Txn(req TxnRequest) (TxnResponse, error) {
+	ln.txnMu.Lock()
+	defer ln.txnMu.Unlock()
+
+	succeeded := true
+	for _, cmp := range req.Compares {
+		if !ln.evaluateCompare(cmp) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := req.Then
+	if !succeeded {
+		ops = req.Else
+	}
+
+	responses := make([]TxnOpResult, 0, len(ops))
+	for _, op := range ops {
+		result, err := ln.applyTxnOp(op)
+		if err != nil {
+			return TxnResponse{}, err
+		}
+		responses = append(responses, result)
+	}
+
+	return TxnResponse{Succeeded: succeeded, Responses: responses}, nil
+}
+
+// evaluateCompare checks a single TxnCompare against the local siblings.
+func (ln *LeaderlessNode) evaluateCompare(cmp TxnCompare) bool {
+	siblings, rawExists := ln.kvStore.Get(cmp.Key)
+	exists := rawExists && !(len(siblings) == 1 && siblings[0].Deleted)
+
+	if cmp.Exists != nil && exists != *cmp.Exists {
+		return false
+	}
+	if cmp.ExpectedVersion == nil && cmp.ExpectedValue == nil {
+		return true
 	}
-	return 200, pair.Value, pair.Version, nil
+	if len(siblings) != 1 || !exists {
+		return false
+	}
+	if cmp.ExpectedVersion != nil && siblings[0].Version != *cmp.ExpectedVersion {
+		return false
+	}
+	if cmp.ExpectedValue != nil && siblings[0].Value != *cmp.ExpectedValue {
+		return false
+	}
+	return true
+}
+
+// applyTxnOp applies a single op locally and, for a mutating op, replicates
+// it to peers under the existing W-quorum rules before returning.
+func (ln *LeaderlessNode) applyTxnOp(op TxnOp) (TxnOpResult, error) {
+	switch {
+	case op.Put != nil:
+		pair := ln.kvStore.Set(op.Put.Key, op.Put.Value, ln.nodeID, nil)
+		ln.markKeyDirty(op.Put.Key)
+		if err := ln.replicateTxnMutation(op.Put.Key, pair); err != nil {
+			return TxnOpResult{}, err
+		}
+		return TxnOpResult{Key: op.Put.Key, Value: pair.Value, Version: pair.Version}, nil
+
+	case op.Delete != nil:
+		pair := ln.kvStore.Delete(op.Delete.Key, ln.nodeID, nil)
+		ln.markKeyDirty(op.Delete.Key)
+		if err := ln.replicateTxnMutation(op.Delete.Key, pair); err != nil {
+			return TxnOpResult{}, err
+		}
+		return TxnOpResult{Key: op.Delete.Key, Deleted: true, Version: pair.Version}, nil
+
+	case op.Get != nil:
+		siblings, exists := ln.kvStore.Get(op.Get.Key)
+		if !exists {
+			return TxnOpResult{Key: op.Get.Key}, nil
+		}
+		if len(siblings) == 1 {
+			return TxnOpResult{Key: op.Get.Key, Value: siblings[0].Value, Version: siblings[0].Version, Deleted: siblings[0].Deleted}, nil
+		}
+		return TxnOpResult{Key: op.Get.Key, Siblings: siblings}, nil
+
+	default:
+		return TxnOpResult{}, fmt.Errorf("txn op must set exactly one of put, delete, or get")
+	}
+}
+
+// replicateTxnMutation fans a Txn Put/Delete's resulting pair out to every
+// peer, the same quorum-then-hint behavior as Write.
+func (ln *LeaderlessNode) replicateTxnMutation(key string, pair KVPair) error {
+	successfulWrites := 1 // Self
+
+	for _, peerURL := range ln.peers() {
+		time.Sleep(200 * time.Millisecond)
+
+		if err := ln.replicateToPeer(peerURL, key, pair); err == nil {
+			successfulWrites++
+		} else {
+			ln.queueHint(peerURL, key, pair)
+		}
+	}
+
+	if successfulWrites >= ln.w {
+		return nil
+	}
+	return fmt.Errorf("failed to meet write quorum")
+}
+
+// Compact prunes dominated siblings from every key's sibling set, reclaiming
+// the history a concurrent write/tombstone has already superseded. Unlike
+// read-repair, which only ever prunes a replica's siblings by pushing a
+// winner it's missing, Compact reconciles a replica against its own stored
+// siblings in place - useful for a node that's accumulated siblings no
+// client has read (and therefore resolved) in a while.
+func (ln *LeaderlessNode) Compact() int {
+	reclaimed := 0
+	for key, siblings := range ln.kvStore.Scan() {
+		merged := mergeSiblingSets(siblings)
+		if len(merged) == len(siblings) {
+			continue
+		}
+		reclaimed += len(siblings) - len(merged)
+		ln.kvStore.Replace(key, merged)
+	}
+	return reclaimed
+}
+
+// VersionsByKey reports the highest version among this node's siblings for
+// every key it holds, so a peer doing a startup delta-sync can tell which
+// of its keys are behind without pulling the full sibling set for each one.
+func (ln *LeaderlessNode) VersionsByKey() map[string]int {
+	scan := ln.kvStore.Scan()
+	versions := make(map[string]int, len(scan))
+	for key, siblings := range scan {
+		max := 0
+		for _, p := range siblings {
+			if p.Version > max {
+				max = p.Version
+			}
+		}
+		versions[key] = max
+	}
+	return versions
+}
+
+// VersionedKeys reports the highest-version sibling's version and value
+// for every key this node holds, so anti-entropy's Merkle tree can fold
+// the value into each leaf hash instead of comparing version numbers
+// alone.
+func (ln *LeaderlessNode) VersionedKeys() map[string]versionedValue {
+	scan := ln.kvStore.Scan()
+	out := make(map[string]versionedValue, len(scan))
+	for key, siblings := range scan {
+		pair := maxVersionPair(siblings)
+		out[key] = versionedValue{Version: pair.Version, Value: pair.Value}
+	}
+	return out
+}
+
+// StartupSync recovers this node's versionCounter and local data from disk
+// (already done by the time this is called, via the KVStore passed to
+// NewLeaderlessNode) and then pulls a delta sync from every peer: for any
+// key where a peer's max version is ahead of ours, it fetches that peer's
+// siblings and merges them in, the same way read-repair does. It's meant to
+// be run once, right after the server starts listening, so a node that
+// crashed mid-write catches back up to whatever peers accepted while it was
+// down.
+func (ln *LeaderlessNode) StartupSync() {
+	local := ln.VersionsByKey()
+
+	for _, peerURL := range ln.peers() {
+		resp, err := http.Get(peerURL + "/admin/versions")
+		if err != nil {
+			log.Printf("startup sync: peer %s unreachable: %v", peerURL, err)
+			continue
+		}
+
+		var remote map[string]int
+		err = json.NewDecoder(resp.Body).Decode(&remote)
+		resp.Body.Close()
+		if err != nil {
+			log.Printf("startup sync: peer %s returned unreadable versions: %v", peerURL, err)
+			continue
+		}
+
+		for key, remoteVersion := range remote {
+			if remoteVersion <= local[key] {
+				continue
+			}
+			pairs, err := ln.readFromPeer(peerURL, key)
+			if err != nil {
+				log.Printf("startup sync: failed to pull %q from %s: %v", key, peerURL, err)
+				continue
+			}
+			for _, p := range pairs {
+				ln.kvStore.Merge(key, p)
+				ln.markKeyDirty(key)
+			}
+			local[key] = remoteVersion
+		}
+	}
+}
+
+// roleManagerInterval is how often RunRoleManager re-evaluates whether this
+// node should change role.
+const roleManagerInterval = 2 * time.Second
+
+// RunRoleManager watches the cluster's live replica count and, if this node
+// is currently a proxy, promotes it to a replica once that count has
+// stayed below activeSize for longer than promotionDelay; if this node is
+// currently a replica, it demotes itself back to a proxy the moment the
+// count exceeds activeSize. Every proxy (replica) runs this independently -
+// isPromotionCandidate (isDemotionCandidate) is what keeps several proxies
+// (replicas) noticing the same deficit (surplus) from all promoting
+// (demoting) at once. It never returns; callers start it with `go`.
+func (ln *LeaderlessNode) RunRoleManager(activeSize int, promotionDelay time.Duration) {
+	var belowSince time.Time
+	for {
+		time.Sleep(roleManagerInterval)
+		ln.roleManagerTick(activeSize, promotionDelay, &belowSince)
+	}
+}
+
+// roleManagerTick is RunRoleManager's single-pass body, split out so tests
+// can drive it directly instead of sleeping.
+func (ln *LeaderlessNode) roleManagerTick(activeSize int, promotionDelay time.Duration, belowSince *time.Time) {
+	replicas := ln.membership.AliveNodes()
+	replicaCount := len(replicas)
+	if ln.membership.Role() == roleReplica {
+		replicaCount++ // this node counts too, but isn't in AliveNodes (self-excluded)
+	}
+
+	switch ln.membership.Role() {
+	case roleReplica:
+		*belowSince = time.Time{}
+		if replicaCount > activeSize && ln.isDemotionCandidate() {
+			ln.demote()
+		}
+
+	case roleProxy:
+		if replicaCount >= activeSize {
+			*belowSince = time.Time{}
+			return
+		}
+		if belowSince.IsZero() {
+			*belowSince = time.Now()
+			return
+		}
+		if time.Since(*belowSince) < promotionDelay || !ln.isPromotionCandidate() {
+			return
+		}
+		ln.promote(replicas)
+		*belowSince = time.Time{}
+	}
+}
+
+// isPromotionCandidate reports whether this proxy has the lowest URL among
+// every proxy currently believed alive, so a replica deficit several
+// proxies notice in the same tick only promotes one of them instead of
+// overshooting activeSize.
+func (ln *LeaderlessNode) isPromotionCandidate() bool {
+	self := ln.membership.SelfURL()
+	for _, proxyURL := range ln.membership.AliveProxies() {
+		if proxyURL < self {
+			return false
+		}
+	}
+	return true
+}
+
+// isDemotionCandidate reports whether this replica has the highest URL
+// among every replica currently believed alive (including itself), so a
+// surplus several replicas notice on the same tick only demotes one of
+// them instead of crashing the live replica count well below activeSize.
+func (ln *LeaderlessNode) isDemotionCandidate() bool {
+	self := ln.membership.SelfURL()
+	for _, replicaURL := range ln.membership.AliveNodes() {
+		if replicaURL > self {
+			return false
+		}
+	}
+	return true
+}
+
+// promote streams this node's data in from one of the given replicas (one
+// Merkle-sync pass per keyspace range - the same mechanism RunAntiEntropy
+// uses to repair a divergent peer, just run eagerly against an empty
+// store) and then announces itself as a replica, so it starts counting
+// toward W/R quorum.
+func (ln *LeaderlessNode) promote(replicas []string) {
+	if len(replicas) > 0 {
+		source := replicas[mrand.Intn(len(replicas))]
+		for rng := 0; rng < ln.ae.numRanges; rng++ {
+			ln.syncRange(source, rng)
+		}
+		log.Printf("role manager: promoted self to replica after streaming state from %s", source)
+	} else {
+		log.Printf("role manager: promoted self to replica with no replica available to stream state from")
+	}
+	ln.membership.SetRole(roleReplica)
+}
+
+// demote announces this node back as a proxy. It leaves whatever data it
+// already holds in place - harmless, since a proxy's Write/Read/CAS never
+// consult its own store - so a later promotion streams a fresh copy rather
+// than trusting the old one is still current.
+func (ln *LeaderlessNode) demote() {
+	ln.membership.SetRole(roleProxy)
+	log.Printf("role manager: demoted self to proxy")
 }
@@ -1,12 +1,161 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// hintedHandoffInterval is how often RunHintedHandoff checks whether a peer
+// with queued hints has come back up.
+const hintedHandoffInterval = 5 * time.Second
+
+// Defaults for the anti-entropy subsystem, overridable via env vars so a
+// deployment can trade sync latency/bandwidth against keyspace coverage
+// without a code change.
+const (
+	defaultAntiEntropyRanges   = 1024
+	defaultAntiEntropyDepth    = 6
+	defaultAntiEntropyInterval = 10 * time.Second
+)
+
+// antiEntropyConfig reads ANTI_ENTROPY_RANGES, ANTI_ENTROPY_DEPTH, and
+// ANTI_ENTROPY_INTERVAL from the environment, falling back to the defaults
+// above for anything unset or unparsable.
+func antiEntropyConfig() (ranges, depth int, interval time.Duration) {
+	ranges = defaultAntiEntropyRanges
+	if v, err := strconv.Atoi(os.Getenv("ANTI_ENTROPY_RANGES")); err == nil && v > 0 {
+		ranges = v
+	}
+
+	depth = defaultAntiEntropyDepth
+	if v, err := strconv.Atoi(os.Getenv("ANTI_ENTROPY_DEPTH")); err == nil && v > 0 {
+		depth = v
+	}
+
+	interval = defaultAntiEntropyInterval
+	if v, err := time.ParseDuration(os.Getenv("ANTI_ENTROPY_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	return ranges, depth, interval
+}
+
+// gossipProbeInterval is how often a GossipMembership-backed node runs a
+// SWIM probe cycle.
+const gossipProbeInterval = 1 * time.Second
+
+// Defaults for the proxy/replica role manager, overridable via env vars so
+// a deployment can tune how aggressively it promotes standby capacity
+// without a code change.
+const (
+	defaultActiveSize     = 3
+	defaultPromotionDelay = 30 * time.Second
+)
+
+// roleManagerConfig reads ACTIVE_SIZE and PROMOTION_DELAY from the
+// environment, falling back to the defaults above for anything unset or
+// unparsable.
+func roleManagerConfig() (activeSize int, promotionDelay time.Duration) {
+	activeSize = defaultActiveSize
+	if v, err := strconv.Atoi(os.Getenv("ACTIVE_SIZE")); err == nil && v > 0 {
+		activeSize = v
+	}
+
+	promotionDelay = defaultPromotionDelay
+	if v, err := time.ParseDuration(os.Getenv("PROMOTION_DELAY")); err == nil && v > 0 {
+		promotionDelay = v
+	}
+
+	return activeSize, promotionDelay
+}
+
+// createMembership builds this node's Membership by looking up MEMBERSHIP
+// in the environment: "static" (the default) keeps today's fixed PEER_URLS
+// list; "gossip" starts a GossipMembership under SELF_URL and joins the
+// cluster via SEED_URLS, so peers can be added/removed at runtime without
+// restarting every other node.
+func createMembership() (Membership, error) {
+	mode := os.Getenv("MEMBERSHIP")
+	if mode == "" {
+		mode = "static"
+	}
+
+	switch mode {
+	case "static":
+		peerURLs := []string{}
+		if urls := os.Getenv("PEER_URLS"); urls != "" {
+			peerURLs = strings.Split(urls, ",")
+		}
+		return NewStaticMembership(peerURLs), nil
+
+	case "gossip":
+		selfURL := os.Getenv("SELF_URL")
+		if selfURL == "" {
+			return nil, fmt.Errorf("MEMBERSHIP=gossip requires SELF_URL")
+		}
+		gossip := NewGossipMembership(selfURL)
+		if os.Getenv("ROLE") == "proxy" {
+			// Set before Join so the join request already advertises this
+			// node as a proxy, instead of the seed briefly believing it's a
+			// replica until the next gossip round.
+			gossip.SetRole(roleProxy)
+		}
+		if seeds := os.Getenv("SEED_URLS"); seeds != "" {
+			if err := gossip.Join(strings.Split(seeds, ",")); err != nil {
+				return nil, fmt.Errorf("joining cluster: %w", err)
+			}
+		}
+		return gossip, nil
+
+	default:
+		return nil, fmt.Errorf("unknown MEMBERSHIP %q", mode)
+	}
+}
+
+// createKVStore builds a KVStore by looking up STORAGE in the environment,
+// so a node can keep its dataset across restarts by switching to the bolt
+// backend purely via config, with no code changes.
+func createKVStore() (KVStore, error) {
+	storage := os.Getenv("STORAGE")
+	if storage == "" {
+		storage = "memory"
+	}
+
+	switch storage {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		dataDir := os.Getenv("DATA_DIR")
+		if dataDir == "" {
+			dataDir = "data"
+		}
+		return NewBoltStore(filepath.Join(dataDir, "kv.db"))
+	default:
+		return nil, fmt.Errorf("unknown STORAGE %q", storage)
+	}
+}
+
+// hintStorePath returns where the hinted-handoff queue's BoltDB file lives:
+// HINT_STORE_PATH if set, otherwise DATA_DIR/hints.db (DATA_DIR defaulting
+// to "data", the same default createKVStore uses for STORAGE=bolt). The
+// queue persists independently of STORAGE so a memory-backed node still
+// survives a restart without losing writes queued for a down peer.
+func hintStorePath() string {
+	if p := os.Getenv("HINT_STORE_PATH"); p != "" {
+		return p
+	}
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	return filepath.Join(dataDir, "hints.db")
+}
+
 func main() {
 	nodeID := os.Getenv("NODE_ID")
 	if nodeID == "" {
@@ -28,16 +177,38 @@ func main() {
 		r = 1
 	}
 
-	// Parse peer URLs from environment
-	peerURLs := []string{}
-	if urls := os.Getenv("PEER_URLS"); urls != "" {
-		peerURLs = strings.Split(urls, ",")
+	membership, err := createMembership()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := createKVStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hints, err := newHintLog(hintStorePath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	antiEntropyRanges, antiEntropyDepth, antiEntropyInterval := antiEntropyConfig()
+	node := NewLeaderlessNode(nodeID, membership, w, r, store, hints, antiEntropyRanges, antiEntropyDepth)
+
+	log.Println("Recovering local data and syncing with peers...")
+	node.StartupSync()
+
+	go node.RunHintedHandoff(hintedHandoffInterval)
+	go node.RunAntiEntropy(antiEntropyInterval)
+	if gossip, ok := membership.(*GossipMembership); ok {
+		go gossip.Run(gossipProbeInterval)
+		activeSize, promotionDelay := roleManagerConfig()
+		go node.RunRoleManager(activeSize, promotionDelay)
 	}
 
-	node := NewLeaderlessNode(nodeID, peerURLs, w, r)
 	server := NewServer(port, node)
 
-	log.Printf("Starting leaderless node %s on port %s (W=%d, R=%d)\n", nodeID, port, w, r)
+	log.Printf("Starting leaderless node %s on port %s (W=%d, R=%d, versionCounter=%d)\n", nodeID, port, w, r, store.VersionCounter())
 	if err := server.Start(); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	mrand "math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memberState is a node's gossiped SWIM status as seen by this node. A peer
+// only ever transitions forward (alive -> suspect -> dead) unless it
+// refutes a suspicion about itself with a higher incarnation.
+type memberState string
+
+const (
+	stateAlive   memberState = "alive"
+	stateSuspect memberState = "suspect"
+	stateDead    memberState = "dead"
+)
+
+// rank orders states so mergeMember can tell whether an incoming report is
+// "more dead" than what this node already believes.
+func (s memberState) rank() int {
+	switch s {
+	case stateSuspect:
+		return 1
+	case stateDead:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// role is a node's place in the quorum: a replica holds data and counts
+// toward W/R; a proxy holds none, forwards client requests to a replica,
+// and is excluded from quorum counts even though it gossips alongside
+// everyone else.
+type role string
+
+const (
+	roleReplica role = "replica"
+	roleProxy   role = "proxy"
+)
+
+// member is one node's externally-visible gossip state: its URL, this
+// node's current belief about whether it's up, the incarnation number that
+// belief carries, and its role. Incarnation is bumped only by the node it
+// describes, to refute a stale suspect/dead report about itself or to push
+// through its own role change.
+type member struct {
+	URL         string      `json:"url"`
+	State       memberState `json:"state"`
+	Incarnation int         `json:"incarnation"`
+	Role        role        `json:"role"`
+}
+
+// Membership abstracts how a LeaderlessNode discovers which peers are
+// currently reachable, so Write/Read can iterate AliveNodes() instead of a
+// fixed slice baked in at startup. StaticMembership is today's behavior;
+// GossipMembership lets the cluster grow/shrink at runtime.
+type Membership interface {
+	// AliveNodes returns every replica peer URL currently believed alive,
+	// excluding this node's own URL and any proxy (proxies hold no data and
+	// don't count toward W/R quorum).
+	AliveNodes() []string
+	// AliveProxies returns every proxy peer URL currently believed alive,
+	// excluding this node's own URL.
+	AliveProxies() []string
+	// Members returns every known member (any state), for the /members
+	// endpoint.
+	Members() []member
+	// Role reports this node's own current role.
+	Role() role
+	// SetRole changes this node's own role, e.g. when RunRoleManager
+	// promotes a proxy to a replica or demotes one back.
+	SetRole(role)
+	// SelfURL reports this node's own URL, so RunRoleManager can break ties
+	// between several proxies noticing the same deficit at once.
+	SelfURL() string
+}
+
+// StaticMembership is the original fixed peer list: set once at startup
+// from PEER_URLS and never updated, regardless of whether a peer is
+// actually reachable.
+type StaticMembership struct {
+	peerURLs []string
+}
+
+// NewStaticMembership wraps a fixed peer list as a Membership.
+func NewStaticMembership(peerURLs []string) *StaticMembership {
+	return &StaticMembership{peerURLs: peerURLs}
+}
+
+// AliveNodes returns the fixed peer list verbatim.
+func (m *StaticMembership) AliveNodes() []string {
+	return m.peerURLs
+}
+
+// AliveProxies always returns nil: StaticMembership predates proxy/standby
+// nodes and has no way to configure one.
+func (m *StaticMembership) AliveProxies() []string {
+	return nil
+}
+
+// Members reports every configured peer as permanently alive, since
+// StaticMembership has no failure detector to say otherwise.
+func (m *StaticMembership) Members() []member {
+	members := make([]member, len(m.peerURLs))
+	for i, url := range m.peerURLs {
+		members[i] = member{URL: url, State: stateAlive, Role: roleReplica}
+	}
+	return members
+}
+
+// Role always reports roleReplica: StaticMembership has no proxy mode.
+func (m *StaticMembership) Role() role {
+	return roleReplica
+}
+
+// SetRole is a no-op: StaticMembership has no proxy mode to switch into.
+func (m *StaticMembership) SetRole(role) {}
+
+// SelfURL always returns "": StaticMembership was never given its own URL,
+// only its peers'.
+func (m *StaticMembership) SelfURL() string {
+	return ""
+}
+
+// Tuning for GossipMembership's SWIM-style failure detector.
+const (
+	// gossipIndirectFanout is how many other alive peers are asked to
+	// indirectly probe a peer that didn't answer a direct ping.
+	gossipIndirectFanout = 3
+	// gossipPingTimeout bounds both the direct ping and each indirect probe
+	// request, so one slow/dead peer can't stall a whole probe cycle.
+	gossipPingTimeout = 500 * time.Millisecond
+	// gossipSuspectTimeout is how long a peer stays "suspect" before this
+	// node gives up waiting for it to refute and marks it dead.
+	gossipSuspectTimeout = 5 * time.Second
+)
+
+// memberEntry is a member plus the bookkeeping GossipMembership needs that
+// isn't part of the wire representation.
+type memberEntry struct {
+	member
+	suspectSince time.Time
+}
+
+// GossipMembership is a SWIM-style membership layer: it periodically pings
+// a random peer, falls back to asking k other peers to probe it
+// indirectly on timeout, and disseminates alive/suspect/dead state by
+// piggybacking its member list on every ping/probe/join exchange. A new
+// node joins by contacting any seed and receiving its current member list,
+// so the cluster can grow or shrink without restarting every other node.
+type GossipMembership struct {
+	selfURL string
+
+	mu      sync.RWMutex
+	members map[string]*memberEntry
+
+	client *http.Client
+	rnd    *mrand.Rand
+	rndMu  sync.Mutex
+}
+
+// NewGossipMembership creates a GossipMembership for selfURL, seeded with
+// only itself as a member. Call Join to learn about the rest of the
+// cluster, and run Run in a goroutine to start the failure detector.
+func NewGossipMembership(selfURL string) *GossipMembership {
+	g := &GossipMembership{
+		selfURL: selfURL,
+		members: make(map[string]*memberEntry),
+		client:  &http.Client{Timeout: gossipPingTimeout},
+		rnd:     mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}
+	g.members[selfURL] = &memberEntry{member: member{URL: selfURL, State: stateAlive, Role: roleReplica}}
+	return g
+}
+
+// AliveNodes returns every replica peer other than self currently believed
+// alive; proxies are excluded since they hold no data and don't count
+// toward W/R quorum.
+func (g *GossipMembership) AliveNodes() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	urls := make([]string, 0, len(g.members))
+	for url, e := range g.members {
+		if url != g.selfURL && e.State == stateAlive && e.Role == roleReplica {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// AliveProxies returns every proxy peer other than self currently believed
+// alive, for RunRoleManager to pick a promotion candidate.
+func (g *GossipMembership) AliveProxies() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	urls := make([]string, 0, len(g.members))
+	for url, e := range g.members {
+		if url != g.selfURL && e.State == stateAlive && e.Role == roleProxy {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Role reports this node's own current role.
+func (g *GossipMembership) Role() role {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.members[g.selfURL].Role
+}
+
+// SetRole changes this node's own role and bumps its incarnation, the same
+// way refuting a suspicion does, so the change propagates past any stale
+// copy of this node other members have already cached.
+func (g *GossipMembership) SetRole(r role) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	self := g.members[g.selfURL]
+	self.Incarnation++
+	self.Role = r
+}
+
+// SelfURL reports this node's own URL.
+func (g *GossipMembership) SelfURL() string {
+	return g.selfURL
+}
+
+// Members returns every known member (any state), sorted by URL so
+// repeated calls against unchanged state are stable.
+func (g *GossipMembership) Members() []member {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	members := make([]member, 0, len(g.members))
+	for _, e := range g.members {
+		members = append(members, e.member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].URL < members[j].URL })
+	return members
+}
+
+// Join contacts each seed URL in turn and stops at the first that answers,
+// posting this node's own URL to its /gossip/join endpoint and merging the
+// member list it gets back. The new node then already knows every member
+// the seed did, and the seed already knows the new node, without waiting
+// for a probe cycle.
+func (g *GossipMembership) Join(seedURLs []string) error {
+	var lastErr error
+	for _, seed := range seedURLs {
+		if seed == g.selfURL {
+			continue
+		}
+		members, err := g.postJoin(seed)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, m := range members {
+			g.mergeMember(m)
+		}
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no seed URLs to join")
+	}
+	return fmt.Errorf("membership: failed to join via any seed: %w", lastErr)
+}
+
+func (g *GossipMembership) postJoin(seed string) ([]member, error) {
+	body, _ := json.Marshal(g.selfMember())
+	resp, err := g.client.Post(seed+"/gossip/join", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var members []member
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// mergeMember folds an incoming report about a peer into this node's view,
+// following SWIM's merge rule: a strictly higher incarnation always wins; a
+// tied incarnation only wins if the incoming state is "more dead" than what
+// this node already believes. A report about this node itself is instead
+// treated as a suspicion to refute: if it's suspect/dead at an incarnation
+// at or above this node's own, bump this node's incarnation and stay alive.
+func (g *GossipMembership) mergeMember(incoming member) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if incoming.URL == g.selfURL {
+		self := g.members[g.selfURL]
+		if incoming.State != stateAlive && incoming.Incarnation >= self.Incarnation {
+			self.Incarnation = incoming.Incarnation + 1
+			self.State = stateAlive
+		}
+		return
+	}
+
+	existing, ok := g.members[incoming.URL]
+	if !ok {
+		g.members[incoming.URL] = &memberEntry{member: incoming}
+		return
+	}
+	if incoming.Incarnation > existing.Incarnation ||
+		(incoming.Incarnation == existing.Incarnation && incoming.State.rank() > existing.State.rank()) {
+		existing.member = incoming
+		existing.suspectSince = time.Time{}
+	}
+}
+
+// selfMember returns this node's own current member entry, for piggybacking
+// on outgoing ping/probe/join requests.
+func (g *GossipMembership) selfMember() member {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.members[g.selfURL].member
+}
+
+// Run starts the periodic SWIM probe cycle: every interval, ping one random
+// peer (direct, falling back to indirect), updating its believed state.
+// Intended to run in its own goroutine, the same way RunHintedHandoff and
+// RunAntiEntropy do.
+func (g *GossipMembership) Run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		g.probeOnce()
+	}
+}
+
+func (g *GossipMembership) probeOnce() {
+	target := g.randomMember()
+	if target == "" {
+		return
+	}
+
+	if g.ping(target) {
+		g.mergeMember(member{URL: target, State: stateAlive})
+		return
+	}
+
+	if g.indirectProbe(target) {
+		g.mergeMember(member{URL: target, State: stateAlive})
+		return
+	}
+
+	g.markSuspectOrDead(target)
+}
+
+// randomMember picks a random peer other than self, regardless of its
+// current believed state, so a suspect peer keeps being probed instead of
+// being ignored until some other event clears it.
+func (g *GossipMembership) randomMember() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	candidates := make([]string, 0, len(g.members))
+	for url := range g.members {
+		if url != g.selfURL {
+			candidates = append(candidates, url)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	g.rndMu.Lock()
+	defer g.rndMu.Unlock()
+	return candidates[g.rnd.Intn(len(candidates))]
+}
+
+// randomAliveExcluding picks up to n random alive peers, excluding exclude
+// and self, for fanning out indirect probes.
+func (g *GossipMembership) randomAliveExcluding(n int, exclude string) []string {
+	g.mu.RLock()
+	candidates := make([]string, 0, len(g.members))
+	for url, e := range g.members {
+		if url != g.selfURL && url != exclude && e.State == stateAlive {
+			candidates = append(candidates, url)
+		}
+	}
+	g.mu.RUnlock()
+
+	g.rndMu.Lock()
+	g.rnd.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	g.rndMu.Unlock()
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// ping sends a direct gossip ping to target, piggybacking this node's own
+// member entry and merging the member list target sends back. It reports
+// whether target answered at all.
+func (g *GossipMembership) ping(target string) bool {
+	body, _ := json.Marshal(g.selfMember())
+	resp, err := g.client.Post(target+"/gossip/ping", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	var members []member
+	if err := json.NewDecoder(resp.Body).Decode(&members); err == nil {
+		for _, m := range members {
+			g.mergeMember(m)
+		}
+	}
+	return true
+}
+
+// indirectProbe asks up to gossipIndirectFanout other alive peers to probe
+// target on this node's behalf, reporting true the moment any of them says
+// target is reachable.
+func (g *GossipMembership) indirectProbe(target string) bool {
+	helpers := g.randomAliveExcluding(gossipIndirectFanout, target)
+	for _, helper := range helpers {
+		body, _ := json.Marshal(map[string]string{"target": target})
+		resp, err := g.client.Post(helper+"/gossip/probe", "application/json", bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		var result struct {
+			Alive bool `json:"alive"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err == nil && result.Alive {
+			return true
+		}
+	}
+	return false
+}
+
+// markSuspectOrDead records that target failed both a direct ping and every
+// indirect probe: the first such failure marks it suspect, and if it's
+// still suspect after gossipSuspectTimeout with no refutation, dead.
+func (g *GossipMembership) markSuspectOrDead(target string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e, ok := g.members[target]
+	if !ok {
+		return
+	}
+	switch {
+	case e.State == stateAlive:
+		e.State = stateSuspect
+		e.suspectSince = time.Now()
+	case e.State == stateSuspect && time.Since(e.suspectSince) > gossipSuspectTimeout:
+		e.State = stateDead
+		log.Printf("membership: %s marked dead after %s unreachable", target, gossipSuspectTimeout)
+	}
+}
+
+// HandleJoin processes an incoming /gossip/join: it adds the joiner (with
+// whatever role it reports, replica or proxy) as a new member and returns
+// this node's current full member list, so the joiner learns about
+// everyone else in one round trip.
+func (g *GossipMembership) HandleJoin(joiner member) []member {
+	joiner.State = stateAlive
+	g.mergeMember(joiner)
+	return g.Members()
+}
+
+// HandlePing processes an incoming /gossip/ping: it merges the piggybacked
+// sender state and returns this node's current full member list.
+func (g *GossipMembership) HandlePing(sender member) []member {
+	g.mergeMember(sender)
+	return g.Members()
+}
+
+// HandleProbe processes an incoming /gossip/probe: it directly pings
+// target on the asking node's behalf and reports whether target answered.
+func (g *GossipMembership) HandleProbe(target string) bool {
+	return g.ping(target)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStaticMembershipAliveNodes checks that StaticMembership just reports
+// its fixed peer list back, unconditionally alive.
+func TestStaticMembershipAliveNodes(t *testing.T) {
+	m := NewStaticMembership([]string{"http://a", "http://b"})
+
+	alive := m.AliveNodes()
+	if len(alive) != 2 || alive[0] != "http://a" || alive[1] != "http://b" {
+		t.Fatalf("expected both configured peers alive, got %v", alive)
+	}
+
+	for _, member := range m.Members() {
+		if member.State != stateAlive {
+			t.Fatalf("expected StaticMembership to report %s as alive, got %s", member.URL, member.State)
+		}
+	}
+}
+
+// TestGossipMembershipJoinDiscoversPeers starts a two-node gossip cluster
+// (a seed plus a joiner) over real HTTP servers and checks that Join alone
+// - before any probe cycle runs - is enough for both sides to know about
+// each other.
+func TestGossipMembershipJoinDiscoversPeers(t *testing.T) {
+	seedGossip := NewGossipMembership("seed")
+	seedNode := &LeaderlessNode{nodeID: "seed", kvStore: NewMemoryStore(), membership: seedGossip}
+	seedServer := httptest.NewServer((&Server{node: seedNode}).router())
+	defer seedServer.Close()
+	seedGossip.selfURL = seedServer.URL
+	seedGossip.members = map[string]*memberEntry{seedServer.URL: {member: member{URL: seedServer.URL, State: stateAlive, Role: roleReplica}}}
+
+	joinerGossip := NewGossipMembership("http://joiner.invalid")
+	if err := joinerGossip.Join([]string{seedServer.URL}); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	alive := joinerGossip.AliveNodes()
+	if len(alive) != 1 || alive[0] != seedServer.URL {
+		t.Fatalf("expected joiner to discover the seed, got %v", alive)
+	}
+
+	found := false
+	for _, m := range seedGossip.Members() {
+		if m.URL == "http://joiner.invalid" && m.State == stateAlive {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected seed to have admitted the joiner, got %+v", seedGossip.Members())
+	}
+}
+
+// TestGossipMembershipMergeRefutesSelfSuspicion checks SWIM's self-refutal
+// rule: a report that this node is suspect/dead bumps its own incarnation
+// and keeps it alive, rather than actually marking itself down.
+func TestGossipMembershipMergeRefutesSelfSuspicion(t *testing.T) {
+	g := NewGossipMembership("self")
+
+	g.mergeMember(member{URL: "self", State: stateSuspect, Incarnation: 0})
+
+	self := g.members["self"]
+	if self.State != stateAlive {
+		t.Fatalf("expected self to refute suspicion and stay alive, got %s", self.State)
+	}
+	if self.Incarnation <= 0 {
+		t.Fatalf("expected self's incarnation to be bumped above the suspecting report, got %d", self.Incarnation)
+	}
+}
+
+// TestGossipMembershipMergeIgnoresStaleReport checks that a same-incarnation
+// report that's "less dead" never overwrites a more authoritative existing
+// entry, while a strictly higher incarnation does.
+func TestGossipMembershipMergeIgnoresStaleReport(t *testing.T) {
+	g := NewGossipMembership("self")
+	g.mergeMember(member{URL: "http://peer", State: stateDead, Incarnation: 5})
+
+	g.mergeMember(member{URL: "http://peer", State: stateAlive, Incarnation: 5})
+	if g.members["http://peer"].State != stateDead {
+		t.Fatalf("expected a same-incarnation, less-dead report to be ignored, got %s", g.members["http://peer"].State)
+	}
+
+	g.mergeMember(member{URL: "http://peer", State: stateAlive, Incarnation: 6})
+	if g.members["http://peer"].State != stateAlive {
+		t.Fatalf("expected a strictly higher incarnation to win regardless of state, got %s", g.members["http://peer"].State)
+	}
+}
+
+// TestGossipMembershipProbeMarksUnreachablePeerDead checks probeOnce's
+// suspect-then-dead escalation against a peer that never answers.
+func TestGossipMembershipProbeMarksUnreachablePeerDead(t *testing.T) {
+	g := NewGossipMembership("self")
+	g.mergeMember(member{URL: "http://unreachable.invalid:1", State: stateAlive})
+
+	g.probeOnce()
+	if g.members["http://unreachable.invalid:1"].State != stateSuspect {
+		t.Fatalf("expected first failed probe to mark the peer suspect, got %s", g.members["http://unreachable.invalid:1"].State)
+	}
+
+	g.members["http://unreachable.invalid:1"].suspectSince = time.Now().Add(-2 * gossipSuspectTimeout)
+	g.probeOnce()
+	if g.members["http://unreachable.invalid:1"].State != stateDead {
+		t.Fatalf("expected a long-suspect peer to be marked dead, got %s", g.members["http://unreachable.invalid:1"].State)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/sha256"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// merkleHash is a single tree node's digest.
+type merkleHash [sha256.Size]byte
+
+// rangeForKey maps key to one of numRanges keyspace partitions, the
+// coarse-grained unit anti-entropy syncs one at a time so a full-keyspace
+// comparison never has to happen in one round trip.
+func rangeForKey(key string, numRanges int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(numRanges))
+}
+
+// bucketForKey maps key to one of a range's 2^depth leaves. It hashes with
+// a salt distinct from rangeForKey's so a key's bucket within its range
+// isn't just a repeat of its range selection.
+func bucketForKey(key string, depth int) int {
+	h := fnv.New32a()
+	h.Write([]byte("bucket:"))
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(uint(1)<<uint(depth)))
+}
+
+// leafHash is the digest anti-entropy compares for one key: it folds in
+// both version and value, so two replicas holding the same version but
+// different bytes (corruption, or a bug that silently rewrote a value
+// without bumping its clock) still produce different hashes instead of
+// anti-entropy concluding they already agree.
+func leafHash(key string, version int, value string) merkleHash {
+	h := sha256.New()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(version)))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	var out merkleHash
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// combineBucket folds every key-leaf landing in one bucket into a single
+// hash, sorted by key first so the result doesn't depend on scan order.
+func combineBucket(leaves map[string]merkleHash) merkleHash {
+	keys := make([]string, 0, len(leaves))
+	for k := range leaves {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		leaf := leaves[k]
+		h.Write(leaf[:])
+	}
+	var out merkleHash
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+func hashPair(left, right merkleHash) merkleHash {
+	h := sha256.New()
+	h.Write(left[:])
+	h.Write(right[:])
+	var out merkleHash
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// merkleTree is a fixed-shape binary tree over one keyspace range: it
+// always has 2^depth leaves regardless of how many keys actually fall in
+// the range, so two replicas with different data for the same range still
+// build structurally identical trees and can compare them node-by-node at
+// matching (depth, index) coordinates. An empty leaf (no keys hashed into
+// that bucket) has the zero hash.
+type merkleTree struct {
+	depth  int
+	layers [][]merkleHash // layers[0] is the leaves, layers[depth] is the root
+	// keysByBucket lets a sync descend straight to the divergent keys once
+	// it reaches a mismatching leaf, without re-scanning the whole range.
+	keysByBucket [][]string
+	// leafByKey is every key's individual (pre-bucket-combine) leaf hash,
+	// kept around so updateLeaf can recombine a single bucket without
+	// rescanning the whole range.
+	leafByKey map[string]merkleHash
+}
+
+// buildMerkleTree builds a depth-deep tree from keyLeaves (key -> leafHash
+// for every key currently in this range).
+func buildMerkleTree(depth int, keyLeaves map[string]merkleHash) *merkleTree {
+	numLeaves := 1 << uint(depth)
+	buckets := make([]map[string]merkleHash, numLeaves)
+	keysByBucket := make([][]string, numLeaves)
+
+	for key, leaf := range keyLeaves {
+		b := bucketForKey(key, depth)
+		if buckets[b] == nil {
+			buckets[b] = make(map[string]merkleHash)
+		}
+		buckets[b][key] = leaf
+		keysByBucket[b] = append(keysByBucket[b], key)
+	}
+
+	leaves := make([]merkleHash, numLeaves)
+	for i, bucket := range buckets {
+		if len(bucket) == 0 {
+			continue // zero hash
+		}
+		leaves[i] = combineBucket(bucket)
+	}
+
+	layers := [][]merkleHash{leaves}
+	layer := leaves
+	for len(layer) > 1 {
+		next := make([]merkleHash, len(layer)/2)
+		for i := range next {
+			next[i] = hashPair(layer[2*i], layer[2*i+1])
+		}
+		layers = append(layers, next)
+		layer = next
+	}
+
+	leafByKey := make(map[string]merkleHash, len(keyLeaves))
+	for key, leaf := range keyLeaves {
+		leafByKey[key] = leaf
+	}
+
+	return &merkleTree{depth: depth, layers: layers, keysByBucket: keysByBucket, leafByKey: leafByKey}
+}
+
+// updateLeaf folds key's new version and value into the tree in place: it
+// recombines only key's bucket and recomputes the path from that bucket to
+// the root, instead of rebuilding every layer from a fresh scan of the
+// whole range.
+func (t *merkleTree) updateLeaf(key string, version int, value string) {
+	bucket := bucketForKey(key, t.depth)
+	if _, exists := t.leafByKey[key]; !exists {
+		t.keysByBucket[bucket] = append(t.keysByBucket[bucket], key)
+	}
+	t.leafByKey[key] = leafHash(key, version, value)
+
+	bucketLeaves := make(map[string]merkleHash, len(t.keysByBucket[bucket]))
+	for _, k := range t.keysByBucket[bucket] {
+		bucketLeaves[k] = t.leafByKey[k]
+	}
+	t.layers[0][bucket] = combineBucket(bucketLeaves)
+
+	index := bucket
+	for level := 1; level < len(t.layers); level++ {
+		parent := index / 2
+		t.layers[level][parent] = hashPair(t.layers[level-1][2*parent], t.layers[level-1][2*parent+1])
+		index = parent
+	}
+}
+
+// root returns the tree's root hash.
+func (t *merkleTree) root() merkleHash {
+	return t.layers[len(t.layers)-1][0]
+}
+
+// nodeAt returns the hash of the node `index` within the layer `depth`
+// levels above the leaves (depth == t.depth is the root). ok is false if
+// depth/index is out of range.
+func (t *merkleTree) nodeAt(depth, index int) (merkleHash, bool) {
+	if depth < 0 || depth >= len(t.layers) {
+		return merkleHash{}, false
+	}
+	layer := t.layers[depth]
+	if index < 0 || index >= len(layer) {
+		return merkleHash{}, false
+	}
+	return layer[index], true
+}
+
+// keysInBucket returns the keys hashed into leaf bucket `index`.
+func (t *merkleTree) keysInBucket(index int) []string {
+	if index < 0 || index >= len(t.keysByBucket) {
+		return nil
+	}
+	return t.keysByBucket[index]
+}
+
+// antiEntropy holds, per keyspace range, a Merkle tree kept up to date
+// incrementally: every KVStore mutation calls updateKey, which recombines
+// just the mutated key's bucket and recomputes the path to the root,
+// without rescanning the range. A range whose tree hasn't been built yet
+// (no peer has synced it since this process started) is instead marked
+// dirty and built from a full scan the first time it's needed.
+type antiEntropy struct {
+	numRanges int
+	treeDepth int
+
+	mu    sync.Mutex
+	trees map[int]*merkleTree
+	dirty map[int]bool
+}
+
+// newAntiEntropy creates the anti-entropy state for a node with numRanges
+// keyspace partitions, each tracked by a tree treeDepth levels deep
+// (2^treeDepth leaves per range).
+func newAntiEntropy(numRanges, treeDepth int) *antiEntropy {
+	return &antiEntropy{
+		numRanges: numRanges,
+		treeDepth: treeDepth,
+		trees:     make(map[int]*merkleTree),
+		dirty:     make(map[int]bool),
+	}
+}
+
+// updateKey folds key's new version and value into its range's tree in
+// place if that tree has already been built, so the next comparison
+// against a peer sees this write without a full-range rebuild. If the
+// range's tree hasn't been built yet, there's nothing to update
+// incrementally; the range is marked dirty instead, and treeForRange's
+// first call will build it fresh (picking up this key along with
+// everything else already in the range).
+func (ae *antiEntropy) updateKey(key, value string, version int) {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+
+	rng := rangeForKey(key, ae.numRanges)
+	tree, ok := ae.trees[rng]
+	if !ok {
+		ae.dirty[rng] = true
+		return
+	}
+	tree.updateLeaf(key, version, value)
+}
+
+// versionedValue is what anti-entropy needs per key to compute its leaf
+// hash: the winning sibling's version and value, so two replicas at the
+// same version but with diverging content hash differently instead of
+// looking identical.
+type versionedValue struct {
+	Version int
+	Value   string
+}
+
+// treeForRange returns rng's current Merkle tree, rebuilding it from scan
+// (every key currently in the store, along with the version/value to
+// hash) if it's missing or has been marked dirty since it was last built.
+func (ae *antiEntropy) treeForRange(rng int, scan func() map[string]versionedValue) *merkleTree {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+
+	if tree, ok := ae.trees[rng]; ok && !ae.dirty[rng] {
+		return tree
+	}
+
+	keyLeaves := make(map[string]merkleHash)
+	for key, vv := range scan() {
+		if rangeForKey(key, ae.numRanges) == rng {
+			keyLeaves[key] = leafHash(key, vv.Version, vv.Value)
+		}
+	}
+
+	tree := buildMerkleTree(ae.treeDepth, keyLeaves)
+	ae.trees[rng] = tree
+	delete(ae.dirty, rng)
+	return tree
+}
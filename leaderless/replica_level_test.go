@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseReplicaLevelRejectsUnknown checks that parseReplicaLevel accepts
+// the empty string and the three known levels, and rejects anything else.
+func TestParseReplicaLevelRejectsUnknown(t *testing.T) {
+	for _, valid := range []string{"", "one", "quorum", "all"} {
+		if _, err := parseReplicaLevel(valid); err != nil {
+			t.Errorf("parseReplicaLevel(%q) returned unexpected error: %v", valid, err)
+		}
+	}
+	if _, err := parseReplicaLevel("two"); err == nil {
+		t.Fatalf("expected parseReplicaLevel(\"two\") to fail")
+	}
+}
+
+// TestReplicaLevelCount checks that each level resolves against totalNodes
+// the way Dynamo-style tunable consistency expects: ONE always means a
+// single replica, ALL always means every replica, QUORUM is a strict
+// majority, and an empty level defers to the node's own configured W/R.
+func TestReplicaLevelCount(t *testing.T) {
+	cases := []struct {
+		level      ReplicaLevel
+		totalNodes int
+		fallback   int
+		want       int
+	}{
+		{LevelOne, 5, 3, 1},
+		{LevelAll, 5, 3, 5},
+		{LevelQuorum, 5, 3, 3},
+		{LevelQuorum, 4, 3, 3},
+		{"", 5, 3, 3},
+	}
+	for _, c := range cases {
+		if got := c.level.replicaCount(c.totalNodes, c.fallback); got != c.want {
+			t.Errorf("ReplicaLevel(%q).replicaCount(%d, %d) = %d, want %d", c.level, c.totalNodes, c.fallback, got, c.want)
+		}
+	}
+}
+
+// TestCASAbortsOnVersionMismatchThenSucceeds writes a key through node A,
+// replicates it to node B, then checks that a CAS from B expecting a stale
+// version is rejected with 409 while leaving the value untouched, and a
+// follow-up CAS expecting the current version succeeds.
+func TestCASAbortsOnVersionMismatchThenSucceeds(t *testing.T) {
+	storeA := NewMemoryStore()
+	storeB := NewMemoryStore()
+
+	nodeA := NewLeaderlessNode("nodeA", NewStaticMembership(nil), 1, 1, storeA, newTestHintLog(t), 4, 2)
+	nodeB := NewLeaderlessNode("nodeB", NewStaticMembership(nil), 1, 1, storeB, newTestHintLog(t), 4, 2)
+
+	serverA := httptest.NewServer((&Server{port: "", node: nodeA}).router())
+	defer serverA.Close()
+	serverB := httptest.NewServer((&Server{port: "", node: nodeB}).router())
+	defer serverB.Close()
+
+	nodeA.membership = NewStaticMembership([]string{serverB.URL})
+	nodeB.membership = NewStaticMembership([]string{serverA.URL})
+
+	key := "balance"
+	pair := storeA.Set(key, "100", "nodeA", nil)
+	storeB.Merge(key, pair)
+
+	if status, _, err := nodeB.CAS(key, pair.Version-1, "999", LevelOne); status != 409 || err == nil {
+		t.Fatalf("expected a stale expected_version to abort with 409, got status=%d err=%v", status, err)
+	}
+	if siblings, _ := storeB.Get(key); siblings[0].Value != "100" {
+		t.Fatalf("expected aborted CAS to leave the value untouched, got %+v", siblings)
+	}
+
+	status, result, err := nodeB.CAS(key, pair.Version, "200", LevelOne)
+	if err != nil || status != 201 {
+		t.Fatalf("expected CAS against the current version to succeed, got status=%d err=%v", status, err)
+	}
+	if result.Value != "200" {
+		t.Fatalf("expected CAS to apply the new value, got %q", result.Value)
+	}
+}
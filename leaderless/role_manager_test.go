@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGossipMembershipAliveNodesExcludesProxies checks that AliveNodes only
+// ever reports replicas - proxies hold no data and must never count toward
+// W/R quorum, even though they're fully visible via gossip.
+func TestGossipMembershipAliveNodesExcludesProxies(t *testing.T) {
+	g := NewGossipMembership("self")
+	g.mergeMember(member{URL: "http://replica", State: stateAlive, Role: roleReplica})
+	g.mergeMember(member{URL: "http://proxy", State: stateAlive, Role: roleProxy})
+
+	alive := g.AliveNodes()
+	if len(alive) != 1 || alive[0] != "http://replica" {
+		t.Fatalf("expected AliveNodes to report only the replica, got %v", alive)
+	}
+
+	proxies := g.AliveProxies()
+	if len(proxies) != 1 || proxies[0] != "http://proxy" {
+		t.Fatalf("expected AliveProxies to report only the proxy, got %v", proxies)
+	}
+}
+
+// TestRoleManagerPromotesProxyAfterSustainedDeficit sets up a replica
+// holding a key and a standby proxy, then drives the proxy's
+// roleManagerTick until the replica count has been below activeSize long
+// enough: the proxy should stream the replica's data in (via the same
+// Merkle-sync path RunAntiEntropy uses) and announce itself as a replica.
+func TestRoleManagerPromotesProxyAfterSustainedDeficit(t *testing.T) {
+	storeA := NewMemoryStore()
+	storeP := NewMemoryStore()
+
+	gossipA := NewGossipMembership("nodeA")
+	nodeA := NewLeaderlessNode("nodeA", gossipA, 1, 1, storeA, newTestHintLog(t), 4, 2)
+	serverA := httptest.NewServer((&Server{port: "", node: nodeA}).router())
+	defer serverA.Close()
+	gossipA.selfURL = serverA.URL
+	gossipA.members = map[string]*memberEntry{serverA.URL: {member: member{URL: serverA.URL, State: stateAlive, Role: roleReplica}}}
+
+	storeA.Set("counter", "42", "nodeA", nil)
+
+	gossipP := NewGossipMembership("nodeP")
+	gossipP.SetRole(roleProxy)
+	gossipP.mergeMember(member{URL: serverA.URL, State: stateAlive, Role: roleReplica})
+	nodeP := NewLeaderlessNode("nodeP", gossipP, 1, 1, storeP, newTestHintLog(t), 4, 2)
+
+	if nodeP.membership.Role() != roleProxy {
+		t.Fatalf("expected nodeP to start as a proxy")
+	}
+
+	var belowSince time.Time
+	// First tick only starts the deficit clock.
+	nodeP.roleManagerTick(2, 0, &belowSince)
+	if nodeP.membership.Role() != roleProxy {
+		t.Fatalf("expected nodeP to stay a proxy on the first tick")
+	}
+
+	// Second tick, with a zero promotionDelay, should promote.
+	nodeP.roleManagerTick(2, 0, &belowSince)
+	if nodeP.membership.Role() != roleReplica {
+		t.Fatalf("expected nodeP to be promoted to a replica")
+	}
+
+	siblings, exists := storeP.Get("counter")
+	if !exists || len(siblings) != 1 || siblings[0].Value != "42" {
+		t.Fatalf("expected promotion to stream the replica's data in, got exists=%v siblings=%+v", exists, siblings)
+	}
+}
+
+// TestRoleManagerDemotesReplicaOverActiveSize checks the symmetric case: a
+// replica whose presence pushes the live count over activeSize demotes
+// itself back to a proxy.
+func TestRoleManagerDemotesReplicaOverActiveSize(t *testing.T) {
+	gossip := NewGossipMembership("nodeA")
+	gossip.mergeMember(member{URL: "http://peer1", State: stateAlive, Role: roleReplica})
+	gossip.mergeMember(member{URL: "http://peer2", State: stateAlive, Role: roleReplica})
+	node := NewLeaderlessNode("nodeA", gossip, 1, 1, NewMemoryStore(), newTestHintLog(t), 4, 2)
+
+	var belowSince time.Time
+	node.roleManagerTick(2, time.Minute, &belowSince)
+
+	if node.membership.Role() != roleProxy {
+		t.Fatalf("expected a replica over activeSize to demote itself to a proxy, got role=%s", node.membership.Role())
+	}
+}
+
+// TestRoleManagerConcurrentDemotionDemotesOnlyOne checks the tie-break that
+// keeps a cluster with more replicas than activeSize from losing all of
+// them in one tick: several replicas over quota tick simultaneously, and
+// only the highest-URL one should demote.
+func TestRoleManagerConcurrentDemotionDemotesOnlyOne(t *testing.T) {
+	urls := []string{"http://r1", "http://r2", "http://r3"}
+	nodes := make([]*LeaderlessNode, len(urls))
+	for i, url := range urls {
+		gossip := NewGossipMembership(url)
+		for _, peer := range urls {
+			if peer != url {
+				gossip.mergeMember(member{URL: peer, State: stateAlive, Role: roleReplica})
+			}
+		}
+		nodes[i] = NewLeaderlessNode(url, gossip, 1, 1, NewMemoryStore(), newTestHintLog(t), 4, 2)
+	}
+
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		node := node
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var belowSince time.Time
+			node.roleManagerTick(2, time.Minute, &belowSince)
+		}()
+	}
+	wg.Wait()
+
+	demoted := 0
+	for i, node := range nodes {
+		if node.membership.Role() == roleProxy {
+			demoted++
+			if urls[i] != "http://r3" {
+				t.Errorf("expected only the highest-URL replica (http://r3) to demote, but %s did", urls[i])
+			}
+		}
+	}
+	if demoted != 1 {
+		t.Fatalf("expected exactly one replica to demote under concurrent over-quota ticks, got %d", demoted)
+	}
+}
+
+// TestIsPromotionCandidatePicksLowestURL checks the tie-break RunRoleManager
+// relies on so several proxies noticing the same deficit don't all promote
+// at once: only the lowest-URL alive proxy considers itself a candidate.
+func TestIsPromotionCandidatePicksLowestURL(t *testing.T) {
+	lower := NewGossipMembership("http://a")
+	lower.SetRole(roleProxy)
+	lower.mergeMember(member{URL: "http://b", State: stateAlive, Role: roleProxy})
+	nodeLower := NewLeaderlessNode("a", lower, 1, 1, NewMemoryStore(), newTestHintLog(t), 4, 2)
+	if !nodeLower.isPromotionCandidate() {
+		t.Fatalf("expected the lowest-URL proxy to be a promotion candidate")
+	}
+
+	higher := NewGossipMembership("http://b")
+	higher.SetRole(roleProxy)
+	higher.mergeMember(member{URL: "http://a", State: stateAlive, Role: roleProxy})
+	nodeHigher := NewLeaderlessNode("b", higher, 1, 1, NewMemoryStore(), newTestHintLog(t), 4, 2)
+	if nodeHigher.isPromotionCandidate() {
+		t.Fatalf("expected a higher-URL proxy to defer to the lowest one")
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -23,6 +27,12 @@ func NewServer(port string, node *LeaderlessNode) *Server {
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
+	return http.ListenAndServe(":"+s.port, s.router())
+}
+
+// router builds the route table, split out from Start so tests can mount it
+// on an httptest.Server instead of a real listener.
+func (s *Server) router() *mux.Router {
 	r := mux.NewRouter()
 
 	// Register routes
@@ -31,15 +41,135 @@ func (s *Server) Start() error {
 	r.HandleFunc("/replicate", s.handleReplicate).Methods("POST")
 	r.HandleFunc("/local_read/{key}", s.handleLocalRead).Methods("GET")
 	r.HandleFunc("/health", s.handleHealth).Methods("GET")
+	r.HandleFunc("/admin/hints", s.handleHints).Methods("GET")
+	r.HandleFunc("/admin/hints/flush", s.handleHintsFlush).Methods("POST")
+	r.HandleFunc("/admin/versions", s.handleVersions).Methods("GET")
+	r.HandleFunc("/txn", s.handleTxn).Methods("POST")
+	r.HandleFunc("/cas", s.handleCas).Methods("POST")
+	r.HandleFunc("/admin/compact", s.handleCompact).Methods("POST")
+	r.HandleFunc("/merkle/{range}/{depth}/{index}", s.handleMerkle).Methods("GET")
+	r.HandleFunc("/members", s.handleMembers).Methods("GET")
+
+	// A GossipMembership needs to accept peer-to-peer gossip traffic;
+	// StaticMembership doesn't, so these routes are only registered when
+	// they'd actually be handled.
+	if gossip, ok := s.node.membership.(gossipHandler); ok {
+		r.HandleFunc("/gossip/join", s.handleGossipJoin(gossip)).Methods("POST")
+		r.HandleFunc("/gossip/ping", s.handleGossipPing(gossip)).Methods("POST")
+		r.HandleFunc("/gossip/probe", s.handleGossipProbe(gossip)).Methods("POST")
+	}
+
+	return r
+}
+
+// gossipHandler is implemented by Membership layers (GossipMembership) that
+// need to accept peer-to-peer gossip traffic. StaticMembership doesn't
+// implement it, so router() only wires these routes up for a gossip-backed
+// node.
+type gossipHandler interface {
+	HandleJoin(joiner member) []member
+	HandlePing(sender member) []member
+	HandleProbe(target string) bool
+}
+
+// handleMembers reports every member this node's Membership layer currently
+// knows about (any state), for operators.
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.node.Members())
+}
+
+// handleGossipJoin admits a new node into the cluster: it adds the joiner
+// (with whatever role it reports) as alive and replies with this node's
+// current member list.
+func (s *Server) handleGossipJoin(gossip gossipHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var joiner member
+		if err := json.NewDecoder(r.Body).Decode(&joiner); err != nil || joiner.URL == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gossip.HandleJoin(joiner))
+	}
+}
+
+// handleGossipPing answers a direct SWIM ping, merging the sender's
+// piggybacked state and replying with this node's current member list.
+func (s *Server) handleGossipPing(gossip gossipHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sender member
+		if err := json.NewDecoder(r.Body).Decode(&sender); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gossip.HandlePing(sender))
+	}
+}
+
+// handleGossipProbe answers an indirect-probe request on behalf of another
+// node: it pings target itself and reports back whether target answered.
+func (s *Server) handleGossipProbe(gossip gossipHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Target == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"alive": gossip.HandleProbe(req.Target)})
+	}
+}
 
-	return http.ListenAndServe(":"+s.port, r)
+// handleHints reports the hinted-handoff queue per peer plus how many
+// read-repair pushes this node has issued, so an operator (or the
+// load-tester) can see how much anti-entropy work is happening alongside
+// the stale-read rate.
+func (s *Server) handleHints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pending":           s.node.Hints(),
+		"read_repair_count": s.node.ReadRepairs(),
+	})
 }
 
-// handleSet handles set requests - this node becomes write coordinator
+// handleHintsFlush forces an immediate drain attempt against every peer
+// with a queued hint, instead of waiting for RunHintedHandoff's next tick.
+func (s *Server) handleHintsFlush(w http.ResponseWriter, r *http.Request) {
+	s.node.FlushHints()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pending": s.node.Hints(),
+	})
+}
+
+// handleVersions reports the highest version this node holds for every key
+// it has, without the siblings themselves. A node doing a startup delta
+// sync calls this on each peer to find out which of its own keys are
+// behind, before paying for a full /local_read per key.
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.node.VersionsByKey())
+}
+
+// handleSet handles set requests - this node becomes write coordinator.
+// Context is an opaque token from a prior /get response; clients that read
+// siblings should pass it back so the coordinator can resolve them instead
+// of blindly overwriting. Consistency optionally overrides the node's
+// configured W with one/quorum/all for this write alone.
 func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+		Key         string `json:"key"`
+		Value       string `json:"value"`
+		Context     string `json:"context"`
+		Consistency string `json:"consistency"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -47,7 +177,19 @@ func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statusCode, version, err := s.node.Write(req.Key, req.Value)
+	context, err := decodeContext(req.Context)
+	if err != nil {
+		http.Error(w, "Invalid context token", http.StatusBadRequest)
+		return
+	}
+
+	level, err := parseReplicaLevel(req.Consistency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statusCode, pair, err := s.node.Write(req.Key, req.Value, context, level)
 	if err != nil {
 		http.Error(w, err.Error(), statusCode)
 		return
@@ -56,17 +198,93 @@ func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"version":     version,
+		"version":     pair.Version,
+		"context":     encodeContext(pair.Clock),
 		"coordinator": s.node.nodeID,
 	})
 }
 
-// handleGet handles get requests (R=1: read from local)
+// handleGet handles get requests (R=1: read from local). The response
+// carries a top-level value/version (the first sibling, for clients that
+// don't know about siblings) plus the full siblings list and a context
+// token covering all of them.
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
-	statusCode, value, version, err := s.node.Read(key)
+	consistency, staleness, level, err := parseReadConsistency(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statusCode, pairs, err := s.node.Read(key, consistency, staleness, level)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(siblingsResponse(pairs, s.node.nodeID))
+}
+
+// parseReadConsistency reads /get's consistency knobs off the query string.
+// ?staleness=<duration> requests a bounded-staleness read with that bound;
+// ?consistency=eventual requests an unbounded single-replica read;
+// ?consistency=one/quorum/all keeps the existing strong quorum-read path
+// but overrides how many replicas it needs; no params at all, or
+// ?consistency=strong, keeps the node's configured R.
+// ?consistency=bounded without a staleness, or any other consistency value,
+// is an error.
+func parseReadConsistency(r *http.Request) (ReadConsistency, time.Duration, ReplicaLevel, error) {
+	if s := r.URL.Query().Get("staleness"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return "", 0, "", fmt.Errorf("invalid staleness: %w", err)
+		}
+		return ConsistencyBounded, d, "", nil
+	}
+
+	switch r.URL.Query().Get("consistency") {
+	case "", "strong":
+		return ConsistencyStrong, 0, "", nil
+	case "eventual":
+		return ConsistencyEventual, 0, "", nil
+	case "bounded":
+		return "", 0, "", fmt.Errorf("consistency=bounded requires a staleness duration")
+	case "one", "quorum", "all":
+		level, err := parseReplicaLevel(r.URL.Query().Get("consistency"))
+		return ConsistencyStrong, 0, level, err
+	default:
+		return "", 0, "", fmt.Errorf("unknown consistency level %q", r.URL.Query().Get("consistency"))
+	}
+}
+
+// handleCas handles a compare-and-swap request: new_value is written to
+// key only if no replica's current version exceeds expected_version.
+// Consistency optionally overrides the node's configured R/W for the
+// version check and the follow-up write.
+func (s *Server) handleCas(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key             string `json:"key"`
+		ExpectedVersion int    `json:"expected_version"`
+		NewValue        string `json:"new_value"`
+		Consistency     string `json:"consistency"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	level, err := parseReplicaLevel(req.Consistency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statusCode, pair, err := s.node.CAS(req.Key, req.ExpectedVersion, req.NewValue, level)
 	if err != nil {
 		http.Error(w, err.Error(), statusCode)
 		return
@@ -75,18 +293,20 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"value":   value,
-		"version": version,
-		"node":    s.node.nodeID,
+		"version":     pair.Version,
+		"context":     encodeContext(pair.Clock),
+		"coordinator": s.node.nodeID,
 	})
 }
 
 // handleReplicate handles replication requests from other nodes
 func (s *Server) handleReplicate(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Key     string `json:"key"`
-		Value   string `json:"value"`
-		Version int    `json:"version"`
+		Key     string      `json:"key"`
+		Value   string      `json:"value"`
+		Version int         `json:"version"`
+		Clock   VectorClock `json:"clock"`
+		Deleted bool        `json:"deleted"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -94,22 +314,24 @@ func (s *Server) handleReplicate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statusCode := s.node.Replicate(req.Key, req.Value, req.Version)
+	statusCode, appliedAt := s.node.Replicate(req.Key, KVPair{Value: req.Value, Version: req.Version, Clock: req.Clock, Deleted: req.Deleted})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "replicated",
-		"node":   s.node.nodeID,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "replicated",
+		"node":       s.node.nodeID,
+		"applied_at": appliedAt,
 	})
 }
 
-// handleLocalRead handles local read requests (for testing)
+// handleLocalRead handles local read requests (for testing and for peers
+// repairing/merging siblings); it always reports the full siblings list.
 func (s *Server) handleLocalRead(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
-	statusCode, value, version, err := s.node.LocalRead(key)
+	statusCode, pairs, err := s.node.LocalRead(key)
 	if err != nil {
 		http.Error(w, err.Error(), statusCode)
 		return
@@ -117,10 +339,84 @@ func (s *Server) handleLocalRead(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(siblingsResponse(pairs, s.node.nodeID))
+}
+
+// siblingsResponse builds the common /get and /local_read response shape:
+// a backward-compatible top-level value/version taken from the first
+// sibling, plus the full siblings list and a context token that merges
+// every sibling's clock.
+func siblingsResponse(pairs []KVPair, nodeID string) map[string]interface{} {
+	merged := VectorClock{}
+	for _, p := range pairs {
+		merged = merged.merge(p.Clock)
+	}
+
+	resp := map[string]interface{}{
+		"node":     nodeID,
+		"siblings": pairs,
+		"context":  encodeContext(merged),
+	}
+	if len(pairs) > 0 {
+		resp["value"] = pairs[0].Value
+		resp["version"] = pairs[0].Version
+	}
+	return resp
+}
+
+// handleTxn handles compare-and-swap transaction requests: this node
+// becomes the transaction's coordinator.
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	var req TxnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.node.Txn(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleCompact reclaims this node's sibling history that's already
+// dominated by a newer write or tombstone, reporting how many siblings it
+// dropped.
+func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
+	reclaimed := s.node.Compact()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reclaimed": reclaimed,
+	})
+}
+
+// handleMerkle reports this node's Merkle tree node at the given keyspace
+// range/depth/index, for a peer's RunAntiEntropy to compare against its own.
+func (s *Server) handleMerkle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rng, err1 := strconv.Atoi(vars["range"])
+	depth, err2 := strconv.Atoi(vars["depth"])
+	index, err3 := strconv.Atoi(vars["index"])
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.Error(w, "range, depth, and index must be integers", http.StatusBadRequest)
+		return
+	}
+
+	hash, keys, ok := s.node.MerkleNode(rng, depth, index)
+	if !ok {
+		http.Error(w, "no such merkle node", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"value":   value,
-		"version": version,
-		"node":    s.node.nodeID,
+		"hash": hex.EncodeToString(hash[:]),
+		"keys": keys,
 	})
 }
 
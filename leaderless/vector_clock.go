@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// VectorClock tracks, per node, how many local writes that node has applied
+// on the causal path leading to a value. Comparing two clocks tells us
+// whether one write happened-before another, or whether they're concurrent
+// and need to be kept as siblings instead of picked by last-write-wins.
+type VectorClock map[string]uint64
+
+// clone returns a copy of vc so callers can mutate the result without
+// aliasing the original.
+func (vc VectorClock) clone() VectorClock {
+	out := make(VectorClock, len(vc))
+	for node, count := range vc {
+		out[node] = count
+	}
+	return out
+}
+
+// merge returns the component-wise maximum of vc and other, the standard
+// way to fold a remote clock into a local one before incrementing it.
+func (vc VectorClock) merge(other VectorClock) VectorClock {
+	out := vc.clone()
+	for node, count := range other {
+		if count > out[node] {
+			out[node] = count
+		}
+	}
+	return out
+}
+
+// clockRelation is the causal relationship between two vector clocks.
+type clockRelation int
+
+const (
+	clockEqual clockRelation = iota
+	clockBefore
+	clockAfter
+	clockConcurrent
+)
+
+// compareClocks reports how a relates to b: equal, strictly before (a
+// happened-before b), strictly after (b happened-before a), or concurrent
+// (neither dominates, so both must be kept as siblings).
+func compareClocks(a, b VectorClock) clockRelation {
+	aGreater, bGreater := false, false
+
+	for node, av := range a {
+		if av > b[node] {
+			aGreater = true
+		} else if av < b[node] {
+			bGreater = true
+		}
+	}
+	for node, bv := range b {
+		if _, ok := a[node]; ok {
+			continue // already compared above
+		}
+		if bv > 0 {
+			bGreater = true
+		}
+	}
+
+	switch {
+	case aGreater && bGreater:
+		return clockConcurrent
+	case aGreater:
+		return clockAfter
+	case bGreater:
+		return clockBefore
+	default:
+		return clockEqual
+	}
+}
+
+// resolveEqualClock decides which of two siblings holding the same vector
+// clock to keep. Under normal operation an equal clock means incoming is
+// just a retransmission of the same write, so its value matches exactly.
+// But a clock can't detect corruption that rewrites a value without going
+// through Set/Merge (a disk error, a direct store write) - anti-entropy's
+// Merkle comparison catches that case by content instead, and both sides
+// of the repair need to land on the same pair without either one treating
+// itself as authoritative just because it's "existing". Breaking the tie
+// on Value (not on which side is incoming) guarantees that: whichever
+// replica calls Merge, the same pair wins.
+func resolveEqualClock(incoming, existing KVPair) KVPair {
+	if incoming.Value == existing.Value && incoming.Deleted == existing.Deleted {
+		return existing
+	}
+	if incoming.Value < existing.Value {
+		return incoming
+	}
+	return existing
+}
+
+// encodeContext turns a vector clock into the opaque token clients are
+// expected to pass back on their next write so the coordinator can resolve
+// siblings deterministically instead of guessing which one they saw.
+func encodeContext(vc VectorClock) string {
+	data, _ := json.Marshal(vc)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeContext reverses encodeContext. An empty token decodes to a nil
+// clock, meaning "no context": the coordinator merges whatever siblings it
+// already has instead of trusting the client to have seen them all.
+func decodeContext(token string) (VectorClock, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var vc VectorClock
+	if err := json.Unmarshal(data, &vc); err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
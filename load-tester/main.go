@@ -19,16 +19,31 @@ import (
 type LoadTester struct {
 	mode               string
 	urls               []string
+	proxyURLs          []string
 	numKeys            int
 	writeLatencies     []float64
 	readLatencies      []float64
 	staleReads         []StaleRead
+	siblingEvents      []SiblingEvent
 	readWriteIntervals []float64
 	versions           map[string]VersionInfo
 	keyAccessTimes     map[string][]AccessInfo
+	hintQueueDepths    map[string]int
+	readRepairCounts   map[string]int64
+	casResults         []CasResult
 	mu                 sync.Mutex
 }
 
+// CasResult records the outcome of a single CAS attempt fired by the
+// cas-mix workload, tagged with the consistency level it ran at so
+// PrintStatistics can break the abort rate down per level.
+type CasResult struct {
+	Key         string  `json:"key"`
+	Consistency string  `json:"consistency"`
+	Aborted     bool    `json:"aborted"`
+	Latency     float64 `json:"latency"`
+}
+
 // VersionInfo tracks version and timestamp for a key
 type VersionInfo struct {
 	Version   int
@@ -41,7 +56,9 @@ type AccessInfo struct {
 	OpType    string // "read" or "write"
 }
 
-// StaleRead represents a stale read event
+// StaleRead represents a stale read event: the key came back 404 even
+// though this tester already wrote it, meaning replication hasn't reached
+// the node that served the read yet.
 type StaleRead struct {
 	Key             string  `json:"key"`
 	ExpectedVersion int     `json:"expected_version"`
@@ -49,17 +66,46 @@ type StaleRead struct {
 	TimeSinceWrite  float64 `json:"time_since_write"`
 }
 
-// NewLoadTester creates a new load tester
-func NewLoadTester(mode string, urls []string, numKeys int) *LoadTester {
+// SiblingEvent represents a read that came back with more than one
+// sibling - two writes raced without either seeing the other, so the
+// client is responsible for resolving them (by echoing /get's context
+// token back on its next /set) instead of one silently overwriting the
+// other under last-write-wins.
+type SiblingEvent struct {
+	Key            string  `json:"key"`
+	SiblingCount   int     `json:"sibling_count"`
+	TimeSinceWrite float64 `json:"time_since_write"`
+}
+
+// NewLoadTester creates a new load tester. proxyURLs, if non-empty,
+// routes reads (and CAS attempts, which start with a read) through those
+// proxy nodes instead of urls, exercising a proxy-fronted deployment's
+// read-scaling path the way a client that only knows the proxy addresses
+// would.
+func NewLoadTester(mode string, urls, proxyURLs []string, numKeys int) *LoadTester {
 	return &LoadTester{
 		mode:           mode,
 		urls:           urls,
+		proxyURLs:      proxyURLs,
 		numKeys:        numKeys,
 		versions:       make(map[string]VersionInfo),
 		keyAccessTimes: make(map[string][]AccessInfo),
 	}
 }
 
+// readURL picks which node a read (or a CAS's version check) should hit:
+// a random proxy if any were configured, otherwise the same node selection
+// WriteOperation uses.
+func (lt *LoadTester) readURL() string {
+	if len(lt.proxyURLs) > 0 {
+		return lt.proxyURLs[rand.Intn(len(lt.proxyURLs))]
+	}
+	if lt.mode == "leaderless" {
+		return lt.urls[rand.Intn(len(lt.urls))]
+	}
+	return lt.urls[0]
+}
+
 // WriteOperation performs a write operation
 func (lt *LoadTester) WriteOperation(key, value string) (float64, bool) {
 	url := lt.urls[0]
@@ -108,11 +154,9 @@ func (lt *LoadTester) WriteOperation(key, value string) (float64, bool) {
 // ReadOperation performs a read operation
 func (lt *LoadTester) ReadOperation(key string) (float64, bool) {
 	// Leader-Follower: ALL reads go to leader (who coordinates with R nodes)
-	// Leaderless: Reads go to any random node (local read only)
-	url := lt.urls[0]
-	if lt.mode == "leaderless" {
-		url = lt.urls[rand.Intn(len(lt.urls))]
-	}
+	// Leaderless: reads go to any random node (local read only), or to a
+	// proxy if any were configured
+	url := lt.readURL()
 
 	start := time.Now()
 	resp, err := http.Get(url + "/get/" + key)
@@ -131,23 +175,25 @@ func (lt *LoadTester) ReadOperation(key string) (float64, bool) {
 
 	if resp.StatusCode == 200 {
 		var result struct {
-			Value   string `json:"value"`
-			Version int    `json:"version"`
+			Value    string            `json:"value"`
+			Version  int               `json:"version"`
+			Siblings []json.RawMessage `json:"siblings"`
 		}
 		json.NewDecoder(resp.Body).Decode(&result)
 
-		// Check if version is stale
+		// Under vector clocks, a lower version than the last write we saw
+		// no longer means the read is stale - it can just as easily mean
+		// this replica hasn't merged a concurrent write yet and is still
+		// holding it as a sibling. So the signal worth tracking is whether
+		// the read surfaced more than one sibling, not a version regression.
 		lt.mu.Lock()
-		if keyExists {
-			if result.Version < vInfo.Version {
-				isStale = true
-				lt.staleReads = append(lt.staleReads, StaleRead{
-					Key:             key,
-					ExpectedVersion: vInfo.Version,
-					ActualVersion:   result.Version,
-					TimeSinceWrite:  time.Since(vInfo.Timestamp).Seconds(),
-				})
+		if len(result.Siblings) > 1 {
+			isStale = true
+			event := SiblingEvent{Key: key, SiblingCount: len(result.Siblings)}
+			if keyExists {
+				event.TimeSinceWrite = time.Since(vInfo.Timestamp).Seconds()
 			}
+			lt.siblingEvents = append(lt.siblingEvents, event)
 		}
 		lt.keyAccessTimes[key] = append(lt.keyAccessTimes[key], AccessInfo{
 			Timestamp: time.Now(),
@@ -179,13 +225,67 @@ func (lt *LoadTester) ReadOperation(key string) (float64, bool) {
 	return latency, isStale
 }
 
-// GenerateWorkload generates the test workload
-func (lt *LoadTester) GenerateWorkload(duration int, writeRatio float64, opsPerSecond int) {
+// casConsistencyLevels are the per-request consistency levels the cas-mix
+// workload picks from at random, matching leaderless/kv_store.go's
+// parseReplicaLevel.
+var casConsistencyLevels = []string{"one", "quorum", "all"}
+
+// CasOperation performs a compare-and-swap against a random consistency
+// level: it reads the key's current version locally, then races a /cas
+// call expecting that version. A concurrent write from elsewhere in the
+// workload can land between the read and the CAS, so an abort here is
+// exactly the signal this workload mode exists to measure, not a bug.
+func (lt *LoadTester) CasOperation(key string) (float64, bool, bool) {
+	url := lt.readURL()
+	consistency := casConsistencyLevels[rand.Intn(len(casConsistencyLevels))]
+
+	expectedVersion := 0
+	if resp, err := http.Get(url + "/get/" + key); err == nil {
+		var current struct {
+			Version int `json:"version"`
+		}
+		json.NewDecoder(resp.Body).Decode(&current)
+		resp.Body.Close()
+		expectedVersion = current.Version
+	}
+
+	payload := map[string]interface{}{
+		"key":              key,
+		"expected_version": expectedVersion,
+		"new_value":        fmt.Sprintf("cas_value_%d", time.Now().UnixNano()),
+		"consistency":      consistency,
+	}
+	jsonData, _ := json.Marshal(payload)
+
+	start := time.Now()
+	resp, err := http.Post(url+"/cas", "application/json", bytes.NewBuffer(jsonData))
+	latency := time.Since(start).Seconds()
+	if err != nil {
+		return latency, false, false
+	}
+	defer resp.Body.Close()
+
+	aborted := resp.StatusCode == http.StatusConflict
+	lt.mu.Lock()
+	lt.casResults = append(lt.casResults, CasResult{Key: key, Consistency: consistency, Aborted: aborted, Latency: latency})
+	lt.mu.Unlock()
+
+	return latency, aborted, resp.StatusCode == 201 || aborted
+}
+
+// GenerateWorkload generates the test workload. casRatio carves the given
+// fraction of write operations out as CAS attempts instead (see
+// CasOperation), so the cas-mix use case can ride the same key pool and
+// concurrency as a normal run instead of needing a separate code path.
+func (lt *LoadTester) GenerateWorkload(duration int, writeRatio, casRatio float64, opsPerSecond int) {
 	fmt.Printf("\nStarting load test:\n")
 	fmt.Printf("  Mode: %s\n", lt.mode)
 	fmt.Printf("  Duration: %d seconds\n", duration)
 	fmt.Printf("  Write ratio: %.0f%%\n", writeRatio*100)
 	fmt.Printf("  Read ratio: %.0f%%\n", (1-writeRatio)*100)
+	if casRatio > 0 {
+		fmt.Printf("  CAS share of writes: %.0f%%\n", casRatio*100)
+	}
 	fmt.Printf("  Target QPS: %d\n", opsPerSecond)
 
 	startTime := time.Now()
@@ -208,6 +308,7 @@ func (lt *LoadTester) GenerateWorkload(duration int, writeRatio float64, opsPerS
 
 		// Decide operation type
 		isWrite := rand.Float64() < writeRatio
+		isCas := isWrite && rand.Float64() < casRatio
 
 		// Select key
 		key := keyPool[rand.Intn(len(keyPool))]
@@ -216,22 +317,25 @@ func (lt *LoadTester) GenerateWorkload(duration int, writeRatio float64, opsPerS
 		wg.Add(1)
 
 		// Fire operation asynchronously to allow concurrency
-		go func(k string, write bool) {
+		go func(k string, write, cas bool) {
 			defer wg.Done()
 
-			if write {
+			switch {
+			case cas:
+				lt.CasOperation(k)
+			case write:
 				value := fmt.Sprintf("value_%d", time.Now().UnixNano())
 				latency, _ := lt.WriteOperation(k, value)
 				lt.mu.Lock()
 				lt.writeLatencies = append(lt.writeLatencies, latency)
 				lt.mu.Unlock()
-			} else {
+			default:
 				latency, _ := lt.ReadOperation(k)
 				lt.mu.Lock()
 				lt.readLatencies = append(lt.readLatencies, latency)
 				lt.mu.Unlock()
 			}
-		}(key, isWrite)
+		}(key, isWrite, isCas)
 	}
 
 	fmt.Printf("Fired %d operations, waiting for completion...\n", operationCount)
@@ -239,6 +343,43 @@ func (lt *LoadTester) GenerateWorkload(duration int, writeRatio float64, opsPerS
 	fmt.Printf("Completed %d operations\n", operationCount)
 }
 
+// PollAntiEntropyStats fetches /admin/hints from every node (leaderless-only
+// endpoint) and records each one's hint-queue depth and read-repair count,
+// so anti-entropy behavior can be measured alongside the stale-read and
+// sibling-resolution rates. Nodes that don't answer (wrong mode, or down)
+// are silently skipped.
+func (lt *LoadTester) PollAntiEntropyStats() {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.hintQueueDepths = make(map[string]int)
+	lt.readRepairCounts = make(map[string]int64)
+
+	for _, url := range lt.urls {
+		resp, err := http.Get(url + "/admin/hints")
+		if err != nil {
+			continue
+		}
+
+		var result struct {
+			Pending         map[string][]json.RawMessage `json:"pending"`
+			ReadRepairCount int64                        `json:"read_repair_count"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+
+		depth := 0
+		for _, queued := range result.Pending {
+			depth += len(queued)
+		}
+		lt.hintQueueDepths[url] = depth
+		lt.readRepairCounts[url] = result.ReadRepairCount
+	}
+}
+
 // CalculateIntervals calculates read-write intervals for the same key
 func (lt *LoadTester) CalculateIntervals() {
 	lt.mu.Lock()
@@ -307,6 +448,57 @@ func (lt *LoadTester) PrintStatistics() {
 		}
 	}
 
+	// Sibling-resolution events
+	fmt.Printf("\nSibling Resolutions:\n")
+	fmt.Printf("  Total: %d\n", len(lt.siblingEvents))
+	if len(lt.readLatencies) > 0 {
+		siblingRate := float64(len(lt.siblingEvents)) / float64(len(lt.readLatencies)) * 100
+		fmt.Printf("  Rate: %.2f%%\n", siblingRate)
+	}
+
+	if len(lt.siblingEvents) > 0 {
+		fmt.Println("  Examples:")
+		for i := 0; i < minInt(3, len(lt.siblingEvents)); i++ {
+			se := lt.siblingEvents[i]
+			fmt.Printf("    - Key: %s, Siblings: %d, Time since write: %.2fms\n",
+				se.Key, se.SiblingCount, se.TimeSinceWrite*1000)
+		}
+	}
+
+	// Hinted-handoff / read-repair (leaderless only)
+	if len(lt.hintQueueDepths) > 0 {
+		fmt.Printf("\nAnti-Entropy (hinted handoff / read repair):\n")
+		for _, url := range lt.urls {
+			depth, ok := lt.hintQueueDepths[url]
+			if !ok {
+				continue
+			}
+			fmt.Printf("  %s: hint queue depth=%d, read repairs=%d\n", url, depth, lt.readRepairCounts[url])
+		}
+	}
+
+	// CAS abort rate, broken down by the consistency level each attempt used
+	if len(lt.casResults) > 0 {
+		fmt.Printf("\nCAS Operations (%d total):\n", len(lt.casResults))
+		byLevel := make(map[string][2]int) // [0]=total, [1]=aborted
+		for _, cr := range lt.casResults {
+			counts := byLevel[cr.Consistency]
+			counts[0]++
+			if cr.Aborted {
+				counts[1]++
+			}
+			byLevel[cr.Consistency] = counts
+		}
+		for _, level := range casConsistencyLevels {
+			counts, ok := byLevel[level]
+			if !ok {
+				continue
+			}
+			abortRate := float64(counts[1]) / float64(counts[0]) * 100
+			fmt.Printf("  %s: %d attempts, %d aborted (%.2f%%)\n", level, counts[0], counts[1], abortRate)
+		}
+	}
+
 	// Read-write intervals
 	lt.CalculateIntervals()
 	if len(lt.readWriteIntervals) > 0 {
@@ -325,13 +517,18 @@ func (lt *LoadTester) SaveResults(filename string) error {
 		"write_latencies":      lt.writeLatencies,
 		"read_latencies":       lt.readLatencies,
 		"stale_reads":          lt.staleReads,
+		"sibling_events":       lt.siblingEvents,
+		"hint_queue_depths":    lt.hintQueueDepths,
+		"read_repair_counts":   lt.readRepairCounts,
 		"read_write_intervals": lt.readWriteIntervals,
+		"cas_results":          lt.casResults,
 		"statistics": map[string]interface{}{
-			"total_writes":      len(lt.writeLatencies),
-			"total_reads":       len(lt.readLatencies),
-			"total_stale_reads": len(lt.staleReads),
-			"write_avg_latency": mean(lt.writeLatencies),
-			"read_avg_latency":  mean(lt.readLatencies),
+			"total_writes":         len(lt.writeLatencies),
+			"total_reads":          len(lt.readLatencies),
+			"total_stale_reads":    len(lt.staleReads),
+			"total_sibling_events": len(lt.siblingEvents),
+			"write_avg_latency":    mean(lt.writeLatencies),
+			"read_avg_latency":     mean(lt.readLatencies),
 		},
 	}
 
@@ -420,58 +617,25 @@ func minInt(a, b int) int {
 	return b
 }
 
-func min(nums ...interface{}) interface{} {
-	switch v := nums[0].(type) {
-	case int:
-		minVal := v
-		for _, num := range nums[1:] {
-			if n, ok := num.(int); ok && n < minVal {
-				minVal = n
-			}
-		}
-		return minVal
-	case []float64:
-		if len(v) == 0 {
-			return 0.0
-		}
-		minVal := v[0]
-		for _, num := range v {
-			if num < minVal {
-				minVal = num
-			}
-		}
-		return minVal
->>>>>>> 4177218 (Update leaderless)
-	}
-	minVal := data[0]
-	for _, v := range data {
-		if v < minVal {
-			minVal = v
-		}
-	}
-	return minVal
-}
-
-func minInt(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func main() {
 	mode := flag.String("mode", "leader", "Database mode: leader or leaderless")
 	writeRatio := flag.Float64("write-ratio", 0.5, "Write ratio (0.0-1.0)")
+	casRatio := flag.Float64("cas-ratio", 0, "Fraction of writes to fire as CAS instead (0.0-1.0), picking one/quorum/all consistency at random so the abort-rate breakdown characterizes the CAP tradeoff")
 	duration := flag.Int("duration", 60, "Test duration in seconds")
 	qps := flag.Int("qps", 10, "Operations per second")
 	numKeys := flag.Int("num-keys", 50, "Number of keys (smaller = more conflicts)")
 	output := flag.String("output", "results.json", "Output filename")
+	nodes := flag.String("nodes", "", "Comma-separated node URLs to target, overriding the built-in defaults (use this against a gossip-membership cluster whose members changed since these defaults were written)")
+	proxyURLs := flag.String("proxy-urls", "", "Comma-separated proxy node URLs; if set, reads (and CAS version checks) are routed through these instead of -nodes, exercising a proxy-fronted deployment's read-scaling path")
 
 	flag.Parse()
 
 	// Configure URLs
 	var urls []string
-	if *mode == "leader" {
+	switch {
+	case *nodes != "":
+		urls = strings.Split(*nodes, ",")
+	case *mode == "leader":
 		// For leader-follower, include leader + all followers
 		// Writes go to leader, reads distributed across all nodes
 		urls = []string{
@@ -481,7 +645,7 @@ func main() {
 			"http://localhost:8083", // Follower 3
 			"http://localhost:8084", // Follower 4
 		}
-	} else {
+	default:
 		urls = []string{
 			"http://localhost:8081",
 			"http://localhost:8082",
@@ -491,11 +655,20 @@ func main() {
 		}
 	}
 
+	var proxies []string
+	if *proxyURLs != "" {
+		proxies = strings.Split(*proxyURLs, ",")
+	}
+
 	// Create tester
-	tester := NewLoadTester(*mode, urls, *numKeys)
+	tester := NewLoadTester(*mode, urls, proxies, *numKeys)
 
 	// Run test
-	tester.GenerateWorkload(*duration, *writeRatio, *qps)
+	tester.GenerateWorkload(*duration, *writeRatio, *casRatio, *qps)
+
+	if *mode == "leaderless" {
+		tester.PollAntiEntropyStats()
+	}
 
 	// Print and save results
 	tester.PrintStatistics()
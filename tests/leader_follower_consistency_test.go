@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -169,6 +173,190 @@ func TestLeaderFollowerInconsistencyWindow(t *testing.T) {
 	}
 }
 
+// TestConcurrentWritePartition has two writers race a /set against the
+// same key without coordinating a context between them, then asserts the
+// conflict is surfaced as siblings and that /resolve collapses it back to
+// a single value every follower converges on.
+//
+// Unlike the leaderless package's equivalent test, this can't literally aim
+// the two writers at different nodes: leader-follower has exactly one node
+// that accepts writes, and every follower rejects /set outright. The
+// "partition" this test approximates is two clients that each read an
+// empty/stale context before the other's write landed - which is exactly
+// the condition SetVC's conflict check is built to catch, regardless of
+// which node a future multi-writer mode might let them target.
+func TestConcurrentWritePartition(t *testing.T) {
+	key := fmt.Sprintf("test_key_partition_%d", time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	var writeA, writeB WriteResponseLF
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		writeA = writeKeyLF(leaderURL, key, "value-from-writer-a")
+	}()
+	go func() {
+		defer wg.Done()
+		writeB = writeKeyLF(leaderURL, key, "value-from-writer-b")
+	}()
+	wg.Wait()
+
+	if writeA.StatusCode != 201 || writeB.StatusCode != 201 {
+		t.Fatalf("expected both writes to succeed, got %d and %d", writeA.StatusCode, writeB.StatusCode)
+	}
+
+	getResp := getKeyWithSiblingsLF(leaderURL, key)
+	if len(getResp.Siblings) != 2 {
+		t.Fatalf("expected 2 siblings after concurrent writes, got %d: %+v", len(getResp.Siblings), getResp.Siblings)
+	}
+	values := map[string]bool{getResp.Siblings[0].Value: true, getResp.Siblings[1].Value: true}
+	if !values["value-from-writer-a"] || !values["value-from-writer-b"] {
+		t.Fatalf("expected siblings to contain both concurrent values, got %+v", getResp.Siblings)
+	}
+
+	resolveResp := resolveKeyLF(leaderURL, key, "merged-value", getResp.Context)
+	if resolveResp.StatusCode != 201 {
+		t.Fatalf("resolve failed: expected 201, got %d", resolveResp.StatusCode)
+	}
+
+	if !waitForConvergenceLF(key, resolveResp.Version, "merged-value", 5*time.Second) {
+		t.Fatalf("followers did not converge on the resolved value")
+	}
+}
+
+// TestBoundedStalenessReadLatency writes a key, lets it replicate, then
+// compares p99 latency of strong (quorum) reads against bounded-staleness
+// reads with a generous bound. Bounded reads should be able to answer from
+// a single already-fresh replica and skip the quorum round-trip, so their
+// p99 should not be slower than strong reads.
+func TestBoundedStalenessReadLatency(t *testing.T) {
+	key := fmt.Sprintf("test_key_staleness_%d", time.Now().UnixNano())
+	value := "test_value_staleness"
+
+	writeResp := writeKeyLF(leaderURL, key, value)
+	if writeResp.StatusCode != 201 {
+		t.Fatalf("Write failed: expected 201, got %d", writeResp.StatusCode)
+	}
+
+	// Let replication settle so every replica is well within any staleness
+	// bound we ask for below.
+	time.Sleep(2 * time.Second)
+
+	const samples = 20
+
+	strongLatencies := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		resp := readKeyLFWithQuery(leaderURL, key, "")
+		strongLatencies = append(strongLatencies, time.Since(start))
+		if resp.StatusCode != 200 || resp.Value != value {
+			t.Fatalf("Strong read failed: status=%d, value=%s", resp.StatusCode, resp.Value)
+		}
+	}
+
+	boundedLatencies := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		resp := readKeyLFWithQuery(leaderURL, key, "staleness=10s")
+		boundedLatencies = append(boundedLatencies, time.Since(start))
+		if resp.StatusCode != 200 || resp.Value != value {
+			t.Fatalf("Bounded-staleness read failed: status=%d, value=%s", resp.StatusCode, resp.Value)
+		}
+	}
+
+	strongP99 := p99(strongLatencies)
+	boundedP99 := p99(boundedLatencies)
+	t.Logf("Strong read p99: %v, bounded-staleness read p99: %v", strongP99, boundedP99)
+
+	if boundedP99 > strongP99 {
+		t.Errorf("bounded-staleness p99 (%v) should not exceed strong read p99 (%v)", boundedP99, strongP99)
+	}
+}
+
+// TestReadRepairConvergence writes a key through the leader, immediately
+// local_reads a follower (likely to observe a stale/404 response during the
+// replication window, same as TestLeaderFollowerInconsistencyWindow), and
+// then asserts that the quorum read this triggers converges every follower
+// on the latest value via read-repair - without any further client-driven
+// write or a fixed sleep.
+func TestReadRepairConvergence(t *testing.T) {
+	key := fmt.Sprintf("test_key_repair_%d", time.Now().UnixNano())
+	value := "test_value_repair"
+
+	writeResp := writeKeyLF(leaderURL, key, value)
+	if writeResp.StatusCode != 201 {
+		t.Fatalf("write failed: expected 201, got %d", writeResp.StatusCode)
+	}
+
+	// A quorum read (R>1) on the leader triggers the background read-repair
+	// pass; /get on the leader always goes through LeaderNode.Read.
+	if resp := readKeyLF(leaderURL, key); resp.StatusCode != 200 || resp.Value != value {
+		t.Fatalf("leader read failed: status=%d value=%s", resp.StatusCode, resp.Value)
+	}
+
+	if !waitForConvergenceLF(key, writeResp.Version, value, 5*time.Second) {
+		t.Fatalf("followers did not converge on version %d via read-repair", writeResp.Version)
+	}
+}
+
+// waitForConvergenceLF polls every follower's local_read until all of them
+// report wantVersion/wantValue or timeout elapses, so tests don't need a
+// fixed sleep to let a background read-repair or hinted-handoff pass
+// finish.
+func waitForConvergenceLF(key string, wantVersion int, wantValue string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		converged := true
+		for _, followerURL := range followerURLs {
+			resp := localReadKeyLF(followerURL, key)
+			if resp.StatusCode != 200 || resp.Value != wantValue || resp.Version != wantVersion {
+				converged = false
+				break
+			}
+		}
+		if converged {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+// hintsPendingLF reports the current total hinted-handoff queue depth
+// across every follower, via the leader's /hints/status endpoint.
+func hintsPendingLF(url string) int {
+	resp, err := http.Get(url + "/hints/status")
+	if err != nil {
+		return -1
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Pending map[string]int `json:"pending"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return -1
+	}
+
+	total := 0
+	for _, n := range result.Pending {
+		total += n
+	}
+	return total
+}
+
+// p99 returns the 99th-percentile duration from samples, which needn't be
+// sorted already.
+func p99(samples []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := (len(sorted) * 99) / 100
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
 // Helper types and functions
 
 type WriteResponseLF struct {
@@ -223,6 +411,355 @@ func readKeyLF(url, key string) ReadResponseLF {
 	}
 }
 
+// SiblingLF mirrors leader-follower/vector_clock.go's Sibling as it appears
+// in a /get response's "siblings" array.
+type SiblingLF struct {
+	Value string            `json:"value"`
+	Clock map[string]uint64 `json:"vv"`
+}
+
+// GetResponseLF is /get's full response shape, including the sibling set
+// and merged context a plain ReadResponseLF ignores.
+type GetResponseLF struct {
+	StatusCode int
+	Value      string
+	Version    int
+	Siblings   []SiblingLF
+	Context    string
+}
+
+// getKeyWithSiblingsLF is readKeyLF but decodes the full response,
+// including any siblings and the context token covering them.
+func getKeyWithSiblingsLF(url, key string) GetResponseLF {
+	resp, err := http.Get(url + "/get/" + key)
+	if err != nil {
+		return GetResponseLF{StatusCode: 500}
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Value    string      `json:"value"`
+		Version  int         `json:"version"`
+		Siblings []SiblingLF `json:"siblings"`
+		Context  string      `json:"context"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	return GetResponseLF{
+		StatusCode: resp.StatusCode,
+		Value:      result.Value,
+		Version:    result.Version,
+		Siblings:   result.Siblings,
+		Context:    result.Context,
+	}
+}
+
+// resolveKeyLF collapses key's sibling set via /resolve, writing back value
+// with the given context (normally the merged context from a prior
+// getKeyWithSiblingsLF call).
+func resolveKeyLF(url, key, value, context string) WriteResponseLF {
+	payload := map[string]string{"key": key, "value": value, "context": context}
+	jsonData, _ := json.Marshal(payload)
+
+	resp, err := http.Post(url+"/resolve", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return WriteResponseLF{StatusCode: 500}
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Version int `json:"version"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	return WriteResponseLF{
+		StatusCode: resp.StatusCode,
+		Version:    result.Version,
+	}
+}
+
+// readKeyLFWithQuery is readKeyLF with an extra raw query string appended,
+// e.g. "staleness=10s" or "consistency=eventual", for exercising /get's
+// consistency knobs.
+func readKeyLFWithQuery(url, key, query string) ReadResponseLF {
+	reqURL := url + "/get/" + key
+	if query != "" {
+		reqURL += "?" + query
+	}
+
+	resp, err := http.Get(reqURL)
+	if err != nil {
+		return ReadResponseLF{StatusCode: 500}
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Value   string `json:"value"`
+		Version int    `json:"version"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	return ReadResponseLF{
+		StatusCode: resp.StatusCode,
+		Value:      result.Value,
+		Version:    result.Version,
+	}
+}
+
+// TestTxnDistributedCounter has 5 concurrent workers race a Txn retry loop
+// (read current version via a Get, then Put incremented-by-one guarded by
+// an ExpectedVersion compare) against the same counter key. Only a
+// conflict-free Txn should ever succeed, so the final value should equal
+// exactly the number of increments attempted, with no lost updates.
+func TestTxnDistributedCounter(t *testing.T) {
+	key := fmt.Sprintf("test_key_txn_counter_%d", time.Now().UnixNano())
+
+	const workers = 5
+	const incrementsPerWorker = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrementsPerWorker; j++ {
+				for {
+					current := txnGetLF(leaderURL, key)
+					next := 1
+					exists := current.Version != 0
+					if exists {
+						n, err := strconv.Atoi(current.Value)
+						if err != nil {
+							t.Errorf("counter value %q is not an integer", current.Value)
+							return
+						}
+						next = n + 1
+					}
+
+					resp := txnLF(leaderURL, TxnRequestLF{
+						Compares: []TxnCompareLF{{Key: key, Exists: &exists, ExpectedVersion: versionPtr(current.Version, exists)}},
+						Then:     []TxnOpLF{{Put: &TxnPutLF{Key: key, Value: strconv.Itoa(next)}}},
+					})
+					if resp.Succeeded {
+						break
+					}
+					// Lost the race to another worker - retry with a fresh read.
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	final := readKeyLF(leaderURL, key)
+	expected := strconv.Itoa(workers * incrementsPerWorker)
+	if final.Value != expected {
+		t.Fatalf("expected counter to reach %s after %d total increments, got %s", expected, workers*incrementsPerWorker, final.Value)
+	}
+	t.Logf("✓ counter reached %s with no lost updates across %d concurrent workers", final.Value, workers)
+}
+
+// TestTxnUniqueKeyInsert has 5 concurrent workers race a Txn guarded by
+// exists=false, each trying to be the first to create the same key. Exactly
+// one should succeed.
+func TestTxnUniqueKeyInsert(t *testing.T) {
+	key := fmt.Sprintf("test_key_txn_unique_%d", time.Now().UnixNano())
+
+	const workers = 5
+	results := make([]bool, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			notExists := false
+			resp := txnLF(leaderURL, TxnRequestLF{
+				Compares: []TxnCompareLF{{Key: key, Exists: &notExists}},
+				Then:     []TxnOpLF{{Put: &TxnPutLF{Key: key, Value: fmt.Sprintf("worker-%d", i)}}},
+			})
+			results[i] = resp.Succeeded
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, ok := range results {
+		if ok {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly 1 worker to win the unique-key insert, got %d", succeeded)
+	}
+	t.Logf("✓ exactly one worker won the unique-key insert")
+}
+
+// versionPtr returns &version when exists is true, and nil otherwise, since
+// ExpectedVersion only makes sense to assert against a key known to exist.
+func versionPtr(version int, exists bool) *int {
+	if !exists {
+		return nil
+	}
+	return &version
+}
+
+// Helper types and functions mirroring leader-follower/kv_store.go's Txn
+// request/response shapes, so tests can drive /txn without importing the
+// main package.
+
+type TxnCompareLF struct {
+	Key             string  `json:"key"`
+	ExpectedVersion *int    `json:"expected_version,omitempty"`
+	ExpectedValue   *string `json:"expected_value,omitempty"`
+	Exists          *bool   `json:"exists,omitempty"`
+}
+
+type TxnPutLF struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type TxnDeleteLF struct {
+	Key string `json:"key"`
+}
+
+type TxnGetLF struct {
+	Key string `json:"key"`
+}
+
+type TxnOpLF struct {
+	Put    *TxnPutLF    `json:"put,omitempty"`
+	Delete *TxnDeleteLF `json:"delete,omitempty"`
+	Get    *TxnGetLF    `json:"get,omitempty"`
+}
+
+type TxnRequestLF struct {
+	Compares []TxnCompareLF `json:"compares"`
+	Then     []TxnOpLF      `json:"then"`
+	Else     []TxnOpLF      `json:"else"`
+}
+
+type TxnOpResultLF struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+type TxnResponseLF struct {
+	Succeeded bool            `json:"succeeded"`
+	Responses []TxnOpResultLF `json:"responses"`
+}
+
+func txnLF(url string, req TxnRequestLF) TxnResponseLF {
+	jsonData, _ := json.Marshal(req)
+
+	resp, err := http.Post(url+"/txn", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return TxnResponseLF{}
+	}
+	defer resp.Body.Close()
+
+	var result TxnResponseLF
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result
+}
+
+// txnGetLF reads key's current value/version through a Get-only Txn, the
+// same path the counter retry loop uses to decide its next write.
+func txnGetLF(url, key string) TxnOpResultLF {
+	resp := txnLF(url, TxnRequestLF{Then: []TxnOpLF{{Get: &TxnGetLF{Key: key}}}})
+	if len(resp.Responses) == 0 {
+		return TxnOpResultLF{}
+	}
+	return resp.Responses[0]
+}
+
+// TestReplicationMetricsObservable writes a key, waits for a replication
+// lag probe cycle, and asserts kv_writes_total, kv_write_quorum_wait_seconds,
+// and kv_replication_lag_seconds are all observable on /metrics - the
+// metrics-based replacement for parsing t.Logf prints that the earlier
+// consistency tests in this file rely on.
+func TestReplicationMetricsObservable(t *testing.T) {
+	key := fmt.Sprintf("test_key_metrics_%d", time.Now().UnixNano())
+
+	writesBefore, ok := scrapeMetricLF(leaderURL, "kv_writes_total", `result="success"`)
+	if !ok {
+		writesBefore = 0
+	}
+
+	writeResp := writeKeyLF(leaderURL, key, "test_value_metrics")
+	if writeResp.StatusCode != 201 {
+		t.Fatalf("write failed: expected 201, got %d", writeResp.StatusCode)
+	}
+
+	writesAfter, ok := scrapeMetricLF(leaderURL, "kv_writes_total", `result="success"`)
+	if !ok {
+		t.Fatalf("kv_writes_total{result=\"success\"} not found on /metrics")
+	}
+	if writesAfter <= writesBefore {
+		t.Errorf("expected kv_writes_total{result=\"success\"} to increase, was %v now %v", writesBefore, writesAfter)
+	}
+
+	if count, ok := scrapeMetricLF(leaderURL, "kv_write_quorum_wait_seconds_count", ""); !ok || count <= 0 {
+		t.Errorf("expected kv_write_quorum_wait_seconds_count > 0, got %v (found=%v)", count, ok)
+	}
+
+	// RunReplicationLagProbe ticks every 5s (replicationLagProbeInterval);
+	// give it a full cycle plus slack before checking the gauge it sets.
+	deadline := time.Now().Add(10 * time.Second)
+	var lag float64
+	var found bool
+	for time.Now().Before(deadline) {
+		if lag, found = scrapeMetricLF(leaderURL, "kv_replication_lag_seconds", fmt.Sprintf(`peer="%s"`, followerURLs[0])); found {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if !found {
+		t.Fatalf("kv_replication_lag_seconds{peer=%q} not observed within timeout", followerURLs[0])
+	}
+	t.Logf("kv_replication_lag_seconds{peer=%q} = %v", followerURLs[0], lag)
+}
+
+// scrapeMetricLF fetches /metrics and returns the value of the first sample
+// line whose metric name is name and whose label string (e.g. `result="ok"`)
+// contains labelSubstr (pass "" to match any/no labels).
+func scrapeMetricLF(url, name, labelSubstr string) (float64, bool) {
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, false
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "#") || !strings.HasPrefix(line, name) {
+			continue
+		}
+		rest := strings.TrimPrefix(line, name)
+		if rest == "" || (rest[0] != ' ' && rest[0] != '{') {
+			continue // name is a prefix of a different metric, e.g. matched "_bucket"
+		}
+		if labelSubstr != "" && !strings.Contains(line, labelSubstr) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			continue
+		}
+		return value, true
+	}
+	return 0, false
+}
+
 func localReadKeyLF(url, key string) ReadResponseLF {
 	resp, err := http.Get(url + "/local_read/" + key)
 	if err != nil {
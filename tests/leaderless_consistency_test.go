@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -190,6 +191,91 @@ func TestConsistencyAfterWrite(t *testing.T) {
 	}
 }
 
+// TestReadRepairConvergence writes through one coordinator, immediately
+// reads from a different node (likely to observe a stale/404 response
+// during the replication window, same as TestLeaderlessInconsistencyWindow),
+// and then asserts that the read-repair pass that read triggers converges
+// every node on the latest value without any further client-driven read.
+//
+// This doesn't exercise hinted handoff's peer-down/peer-recovers path since
+// these tests run against externally-managed nodes this suite can't
+// restart; TestLeaderlessInconsistencyWindow and this test are the
+// closest approximation available in this harness.
+func TestReadRepairConvergence(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	key := fmt.Sprintf("test_key_repair_%d", time.Now().UnixNano())
+	value := "test_value_repair"
+
+	coordinatorIdx := rand.Intn(len(nodeURLs))
+	coordinatorURL := nodeURLs[coordinatorIdx]
+
+	writeResp := writeKeyLeaderless(coordinatorURL, key, value)
+	if writeResp.StatusCode != 201 {
+		t.Fatalf("write failed: expected 201, got %d", writeResp.StatusCode)
+	}
+
+	// Read from a non-coordinator node to trigger a quorum read and its
+	// background read-repair pass.
+	otherIdx := (coordinatorIdx + 1) % len(nodeURLs)
+	_ = readKeyLeaderless(nodeURLs[otherIdx], key)
+
+	// Give the background repair goroutine time to finish.
+	time.Sleep(1 * time.Second)
+
+	for i, nodeURL := range nodeURLs {
+		resp := readKeyLeaderless(nodeURL, key)
+		if resp.StatusCode != 200 || resp.Value != value || resp.Version != writeResp.Version {
+			t.Errorf("Node%d not converged after read repair: status=%d value=%s version=%d", i+1, resp.StatusCode, resp.Value, resp.Version)
+		}
+	}
+}
+
+// TestConcurrentWritesProduceSiblings has two different nodes coordinate a
+// write to the same key at the same time, each without having seen the
+// other's value. Neither write's vector clock dominates the other's, so
+// every replica should end up holding both as siblings instead of one
+// silently clobbering the other.
+//
+// This doesn't use a real network partition (the harness only targets
+// already-running external nodes, same caveat as TestReadRepairConvergence);
+// firing both writes concurrently is enough, since each coordinator computes
+// its own clock locally before replicating, so the two writes are genuinely
+// concurrent regardless of how the replication messages interleave afterward.
+func TestConcurrentWritesProduceSiblings(t *testing.T) {
+	key := fmt.Sprintf("test_key_siblings_%d", time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	var writeA, writeB LeaderlessWriteResponse
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		writeA = writeKeyLeaderless(nodeURLs[0], key, "value-from-node1")
+	}()
+	go func() {
+		defer wg.Done()
+		writeB = writeKeyLeaderless(nodeURLs[1], key, "value-from-node2")
+	}()
+	wg.Wait()
+
+	if writeA.StatusCode != 201 || writeB.StatusCode != 201 {
+		t.Fatalf("expected both writes to succeed, got %d and %d", writeA.StatusCode, writeB.StatusCode)
+	}
+
+	for i, nodeURL := range nodeURLs {
+		siblings := localReadSiblingsLeaderless(nodeURL, key)
+		if len(siblings) != 2 {
+			t.Errorf("Node%d: expected 2 siblings after concurrent writes, got %d: %+v", i+1, len(siblings), siblings)
+			continue
+		}
+
+		values := map[string]bool{siblings[0].Value: true, siblings[1].Value: true}
+		if !values["value-from-node1"] || !values["value-from-node2"] {
+			t.Errorf("Node%d: expected siblings to contain both concurrent values, got %+v", i+1, siblings)
+		}
+	}
+}
+
 // Helper types and functions
 
 type LeaderlessWriteResponse struct {
@@ -205,6 +291,14 @@ type LeaderlessReadResponse struct {
 	Node       string
 }
 
+// KVPairResponse mirrors the leaderless package's KVPair as it appears in
+// /local_read's "siblings" array.
+type KVPairResponse struct {
+	Value   string            `json:"value"`
+	Version int               `json:"version"`
+	Clock   map[string]uint64 `json:"clock"`
+}
+
 func writeKeyLeaderless(url, key, value string) LeaderlessWriteResponse {
 	payload := map[string]string{"key": key, "value": value}
 	jsonData, _ := json.Marshal(payload)
@@ -250,3 +344,191 @@ func readKeyLeaderless(url, key string) LeaderlessReadResponse {
 	}
 }
 
+// localReadSiblingsLeaderless fetches every sibling a node is currently
+// holding for key via /local_read, which reports exactly the sibling set
+// this node holds, with no quorum merge or proxy forwarding.
+func localReadSiblingsLeaderless(url, key string) []KVPairResponse {
+	resp, err := http.Get(url + "/local_read/" + key)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Siblings []KVPairResponse `json:"siblings"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.Siblings
+}
+
+// TestLeaderlessTxnDistributedCounter has 5 workers, each hitting a different node as
+// its Txn coordinator, race a Txn retry loop (read current value via a Get,
+// then Put incremented-by-one guarded by an ExpectedVersion compare)
+// against the same counter key. Only a conflict-free Txn should ever
+// succeed, so the final value should equal exactly the number of increments
+// attempted, with no lost updates.
+func TestLeaderlessTxnDistributedCounter(t *testing.T) {
+	key := fmt.Sprintf("test_key_txn_counter_leaderless_%d", time.Now().UnixNano())
+
+	const incrementsPerWorker = 10
+
+	var wg sync.WaitGroup
+	for i, nodeURL := range nodeURLs {
+		wg.Add(1)
+		go func(nodeURL string, workerIdx int) {
+			defer wg.Done()
+			for j := 0; j < incrementsPerWorker; j++ {
+				for {
+					current := txnGetLeaderless(nodeURL, key)
+					next := 1
+					exists := current.Version != 0
+					if exists {
+						n, err := strconv.Atoi(current.Value)
+						if err != nil {
+							t.Errorf("counter value %q is not an integer", current.Value)
+							return
+						}
+						next = n + 1
+					}
+
+					resp := txnLeaderless(nodeURL, TxnRequestLeaderless{
+						Compares: []TxnCompareLeaderless{{Key: key, Exists: &exists, ExpectedVersion: versionPtrLeaderless(current.Version, exists)}},
+						Then:     []TxnOpLeaderless{{Put: &TxnPutLeaderless{Key: key, Value: strconv.Itoa(next)}}},
+					})
+					if resp.Succeeded {
+						break
+					}
+					// Lost the race to another worker - retry with a fresh read.
+				}
+			}
+		}(nodeURL, i)
+	}
+	wg.Wait()
+
+	time.Sleep(1 * time.Second)
+
+	final := readKeyLeaderless(nodeURLs[0], key)
+	expected := strconv.Itoa(len(nodeURLs) * incrementsPerWorker)
+	if final.Value != expected {
+		t.Fatalf("expected counter to reach %s after %d total increments, got %s", expected, len(nodeURLs)*incrementsPerWorker, final.Value)
+	}
+	t.Logf("✓ counter reached %s with no lost updates across %d concurrent coordinators", final.Value, len(nodeURLs))
+}
+
+// TestLeaderlessTxnUniqueKeyInsert has one worker per node race a Txn guarded by
+// exists=false, each trying to be the first to create the same key. Exactly
+// one should succeed.
+func TestLeaderlessTxnUniqueKeyInsert(t *testing.T) {
+	key := fmt.Sprintf("test_key_txn_unique_leaderless_%d", time.Now().UnixNano())
+
+	results := make([]bool, len(nodeURLs))
+	var wg sync.WaitGroup
+	for i, nodeURL := range nodeURLs {
+		wg.Add(1)
+		go func(nodeURL string, i int) {
+			defer wg.Done()
+			notExists := false
+			resp := txnLeaderless(nodeURL, TxnRequestLeaderless{
+				Compares: []TxnCompareLeaderless{{Key: key, Exists: &notExists}},
+				Then:     []TxnOpLeaderless{{Put: &TxnPutLeaderless{Key: key, Value: fmt.Sprintf("worker-%d", i)}}},
+			})
+			results[i] = resp.Succeeded
+		}(nodeURL, i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, ok := range results {
+		if ok {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly 1 worker to win the unique-key insert, got %d", succeeded)
+	}
+	t.Logf("✓ exactly one worker won the unique-key insert")
+}
+
+// versionPtrLeaderless returns &version when exists is true, and nil
+// otherwise, since ExpectedVersion only makes sense to assert against a key
+// known to exist.
+func versionPtrLeaderless(version int, exists bool) *int {
+	if !exists {
+		return nil
+	}
+	return &version
+}
+
+// Helper types and functions mirroring leaderless/kv_store.go's Txn
+// request/response shapes, so tests can drive /txn without importing the
+// main package.
+
+type TxnCompareLeaderless struct {
+	Key             string  `json:"key"`
+	ExpectedVersion *int    `json:"expected_version,omitempty"`
+	ExpectedValue   *string `json:"expected_value,omitempty"`
+	Exists          *bool   `json:"exists,omitempty"`
+}
+
+type TxnPutLeaderless struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type TxnDeleteLeaderless struct {
+	Key string `json:"key"`
+}
+
+type TxnGetLeaderless struct {
+	Key string `json:"key"`
+}
+
+type TxnOpLeaderless struct {
+	Put    *TxnPutLeaderless    `json:"put,omitempty"`
+	Delete *TxnDeleteLeaderless `json:"delete,omitempty"`
+	Get    *TxnGetLeaderless    `json:"get,omitempty"`
+}
+
+type TxnRequestLeaderless struct {
+	Compares []TxnCompareLeaderless `json:"compares"`
+	Then     []TxnOpLeaderless      `json:"then"`
+	Else     []TxnOpLeaderless      `json:"else"`
+}
+
+type TxnOpResultLeaderless struct {
+	Key      string           `json:"key"`
+	Value    string           `json:"value,omitempty"`
+	Version  int              `json:"version,omitempty"`
+	Deleted  bool             `json:"deleted,omitempty"`
+	Siblings []KVPairResponse `json:"siblings,omitempty"`
+}
+
+type TxnResponseLeaderless struct {
+	Succeeded bool                    `json:"succeeded"`
+	Responses []TxnOpResultLeaderless `json:"responses"`
+}
+
+func txnLeaderless(url string, req TxnRequestLeaderless) TxnResponseLeaderless {
+	jsonData, _ := json.Marshal(req)
+
+	resp, err := http.Post(url+"/txn", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return TxnResponseLeaderless{}
+	}
+	defer resp.Body.Close()
+
+	var result TxnResponseLeaderless
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result
+}
+
+// txnGetLeaderless reads key's current value/version through a Get-only
+// Txn, the same path the counter retry loop uses to decide its next write.
+func txnGetLeaderless(url, key string) TxnOpResultLeaderless {
+	resp := txnLeaderless(url, TxnRequestLeaderless{Then: []TxnOpLeaderless{{Get: &TxnGetLeaderless{Key: key}}}})
+	if len(resp.Responses) == 0 {
+		return TxnOpResultLeaderless{}
+	}
+	return resp.Responses[0]
+}
+